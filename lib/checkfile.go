@@ -0,0 +1,420 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fileError is an error located in file, line is zero if unknown
+type fileError struct {
+	path string
+	line int
+	err  error
+}
+
+func (e *fileError) Error() string {
+	switch {
+	case e.path == "":
+		return e.err.Error()
+	case e.line == 0:
+		return fmt.Sprintf("%s: %v", e.path, e.err)
+	default:
+		return fmt.Sprintf("%s:%d: %v", e.path, e.line, e.err)
+	}
+}
+
+// inFile returns err located in file at path
+func inFile(err error, path string) *fileError {
+	if fe, ok := err.(*fileError); ok {
+		return &fileError{path: path, line: fe.line, err: fe.err}
+	}
+	return &fileError{path: path, err: err}
+}
+
+// yamlLineRe matches line number in YAML syntax errors
+var yamlLineRe = regexp.MustCompile(`(?s)^yaml: line (\d+): (.*)$`)
+
+// atLine returns err located at line start, YAML syntax errors
+// are located at their own lines counted from line start
+func atLine(err error, start int) *fileError {
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return &fileError{line: start + n - 1, err: errors.New("yaml: " + m[2])}
+	}
+	return &fileError{line: start, err: err}
+}
+
+// document is a part of YAML stream with line where it starts
+type document struct {
+	data []byte
+	line int
+}
+
+// splitDocuments splits YAML stream into documents separated by --- lines
+func splitDocuments(b []byte) []document {
+	var docs []document
+	var doc bytes.Buffer
+	start, n := 1, 0
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if strings.TrimRight(line, " \t") == "---" {
+			docs = append(docs, document{data: append([]byte(nil), doc.Bytes()...), line: start})
+			doc.Reset()
+			start = n + 1
+			continue
+		}
+		doc.WriteString(line)
+		doc.WriteByte('\n')
+	}
+	return append(docs, document{data: doc.Bytes(), line: start})
+}
+
+// item is raw fields of a check with lines where it and its fields start
+type item struct {
+	fields defaults
+	line   int
+	keys   map[string]int
+	// decode decodes fields straight into check, so text of values is kept
+	decode func(c *Check) error
+	// query is the rest of .sql file, which is not a part of fields
+	query string
+}
+
+// node is a YAML node which is decoded later, when defaults are known
+type node struct {
+	unmarshal func(interface{}) error
+}
+
+func (n *node) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	n.unmarshal = unmarshal
+	return nil
+}
+
+// decode decodes node into check
+func (n *node) decode(c *Check) error {
+	return n.unmarshal(c)
+}
+
+// keyRe matches YAML mapping key at the start of line
+var keyRe = regexp.MustCompile(`^([\w-]+)\s*:(\s|$)`)
+
+// isBlank checks if line has no YAML content
+func isBlank(line string) bool {
+	s := strings.TrimSpace(line)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// indentOf returns number of leading spaces in line
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// listItemLines returns indexes of lines starting items of top-level YAML list
+func listItemLines(lines []string) []int {
+	var starts []int
+	indent := -1
+	for i, l := range lines {
+		if isBlank(l) {
+			continue
+		}
+		rest := strings.TrimLeft(l, " ")
+		if indent < 0 {
+			indent = indentOf(l)
+		}
+		if indentOf(l) == indent && (rest == "-" || strings.HasPrefix(rest, "- ")) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// keyLines finds lines of top-level keys of YAML mapping in lines,
+// which could be an item of YAML list. First line is numbered first.
+func keyLines(lines []string, first int) map[string]int {
+	keys := make(map[string]int)
+	indent := -1
+	for i, l := range lines {
+		if isBlank(l) {
+			continue
+		}
+		n := indentOf(l)
+		rest := l[n:]
+		if indent < 0 {
+			if rest == "-" || strings.HasPrefix(rest, "- ") {
+				trimmed := strings.TrimLeft(rest[1:], " ")
+				n += len(rest) - len(trimmed)
+				rest = trimmed
+			}
+			indent = n
+		}
+		if n != indent {
+			continue
+		}
+		if m := keyRe.FindStringSubmatch(rest); m != nil {
+			if _, ok := keys[m[1]]; !ok {
+				keys[m[1]] = first + i
+			}
+		}
+	}
+	return keys
+}
+
+// readItems reads raw fields of checks from YAML stream,
+// each document could contain single check or list of checks
+func readItems(b []byte) ([]item, error) {
+	var items []item
+	for _, doc := range splitDocuments(b) {
+		var v interface{}
+		err := yaml.Unmarshal(doc.data, &v)
+		if err != nil {
+			return nil, atLine(err, doc.line)
+		}
+		if v == nil {
+			// empty document
+			continue
+		}
+		lines := strings.Split(string(doc.data), "\n")
+		list, ok := v.([]interface{})
+		// lines where items start, relative to document
+		starts := []int{0}
+		nodes := []*node{{}}
+		if ok {
+			starts = listItemLines(lines)
+			nodes = nil
+			err = yaml.Unmarshal(doc.data, &nodes)
+		} else {
+			list = []interface{}{v}
+			err = yaml.Unmarshal(doc.data, nodes[0])
+		}
+		if err != nil {
+			return nil, atLine(err, doc.line)
+		}
+		for i, it := range list {
+			start, end := 0, len(lines)
+			if len(starts) == len(list) {
+				start = starts[i]
+				if i+1 < len(starts) {
+					end = starts[i+1]
+				}
+			}
+			m, ok := asMap(it)
+			if !ok {
+				return nil, atLine(fmt.Errorf("check #%d: not a valid check, expected mapping of fields", len(items)+1), doc.line+start)
+			}
+			for start < end-1 && isBlank(lines[start]) {
+				start++
+			}
+			items = append(items, item{
+				fields: m,
+				line:   doc.line + start,
+				keys:   keyLines(lines[start:end], doc.line+start),
+				decode: nodes[i].decode,
+			})
+		}
+	}
+	return items, nil
+}
+
+// errFrontMatter is a prefix of errors of leading comments in .sql file which are not check fields
+const errFrontMatter = "leading -- comments are not a valid front-matter with check fields"
+
+// readSQLItems reads check from .sql file, where leading block of -- comments
+// is YAML with check fields, and the rest is a query. File without 'description'
+// or 'assert' keys in leading comments is not a check, like query referenced
+// by query_file or a query with ordinary comments, so no items are returned.
+func readSQLItems(b []byte) ([]item, error) {
+	lines := strings.Split(string(b), "\n")
+	// front-matter with comment markers removed, keeping line numbers
+	var meta []string
+	// first is an index of the first comment line
+	first := -1
+	end := 0
+	for ; end < len(lines); end++ {
+		line := strings.TrimLeft(lines[end], " \t")
+		if first < 0 && strings.TrimSpace(line) == "" {
+			meta = append(meta, "")
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		if first < 0 {
+			first = end
+		}
+		meta = append(meta, strings.TrimPrefix(strings.TrimPrefix(line, "--"), " "))
+	}
+	if first < 0 {
+		return nil, nil
+	}
+	keys := keyLines(meta, 1)
+	_, hasDescription := keys["description"]
+	_, hasAssert := keys["assert"]
+	if !hasDescription && !hasAssert {
+		return nil, nil
+	}
+	var v interface{}
+	data := []byte(strings.Join(meta, "\n"))
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		fe := atLine(err, 1)
+		fe.err = fmt.Errorf("%s: %v", errFrontMatter, fe.err)
+		return nil, fe
+	}
+	fields, ok := asMap(v)
+	if !ok {
+		return nil, atLine(fmt.Errorf("%s, expected 'key: value' lines", errFrontMatter), first+1)
+	}
+	for _, key := range []string{"query", "query_file"} {
+		if _, ok := fields[key]; ok {
+			return nil, atLine(fmt.Errorf("'%s' can't be set in front-matter of .sql check, query is the rest of file", key), keys[key])
+		}
+	}
+	n := &node{}
+	if err := yaml.Unmarshal(data, n); err != nil {
+		return nil, atLine(err, 1)
+	}
+	return []item{{
+		fields: fields,
+		line:   first + 1,
+		keys:   keys,
+		decode: n.decode,
+		query:  strings.TrimSpace(strings.Join(lines[end:], "\n")),
+	}}, nil
+}
+
+// isSQLFile checks if file at path is a .sql file
+func isSQLFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".sql"
+}
+
+// readFileItems reads raw fields of checks from contents of file at path,
+// which is a YAML file or .sql file with front-matter
+func readFileItems(path string, b []byte) ([]item, error) {
+	if isSQLFile(path) {
+		return readSQLItems(b)
+	}
+	return readItems(b)
+}
+
+// queryFileOf returns path of query file referenced by item relative to dir,
+// or empty string if there is none
+func queryFileOf(it item, dir string) string {
+	name, _ := it.fields["query_file"].(string)
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// yamlTypeLineRe matches line number in YAML unmarshal errors
+var yamlTypeLineRe = regexp.MustCompile(`^line \d+: `)
+
+// readItem reads check from its raw fields, taking missing fields from defaults d.
+// Query of query_file field is read from file relative to dir.
+func readItem(it item, d defaultsChain, dir string) (*Check, error) {
+	var c Check
+	for _, layer := range append(append(defaultsChain{}, d...), it) {
+		if err := layer.decodeInto(&c); err != nil {
+			if te, ok := err.(*yaml.TypeError); ok {
+				// lines of YAML nodes are counted from start of their documents
+				var list []string
+				for _, e := range te.Errors {
+					list = append(list, yamlTypeLineRe.ReplaceAllString(e, ""))
+				}
+				err = errors.New("yaml: " + strings.Join(list, ", "))
+			}
+			return nil, err
+		}
+	}
+	if it.query != "" {
+		c.Query = it.query
+	}
+	if v, ok := it.fields["query_file"]; ok {
+		if _, ok := it.fields["query"]; ok {
+			return nil, errors.New("not a valid check, only one of 'query' and 'query_file' could be set")
+		}
+		if name, ok := v.(string); !ok || name == "" {
+			return nil, errors.New("not a valid check, 'query_file' must be a path to file")
+		}
+		query, err := ioutil.ReadFile(queryFileOf(it, dir))
+		if err != nil {
+			return nil, fmt.Errorf("not a valid check, failed to read 'query_file': %v", err)
+		}
+		c.Query = strings.TrimSpace(string(query))
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// readItemChecks reads checks from items, taking missing fields from defaults d
+// and query files relative to dir
+func readItemChecks(items []item, d defaultsChain, dir string) ([]*Check, error) {
+	var checks []*Check
+	for i, it := range items {
+		check, err := readItem(it, d, dir)
+		if err != nil {
+			if len(items) > 1 {
+				err = fmt.Errorf("check #%d: %v", i+1, err)
+			}
+			return nil, atLine(err, it.line)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// readChecks reads checks from io.Reader, taking missing fields from defaults d
+func readChecks(f io.Reader, d defaultsChain) ([]*Check, error) {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	items, err := readItems(b)
+	if err != nil {
+		return nil, err
+	}
+	return readItemChecks(items, d, "")
+}
+
+// ReadChecks reads checks from io.Reader. Checks could be given
+// as a single check, as a list of checks, or as several YAML documents.
+// Query files are read relative to current directory.
+func ReadChecks(f io.Reader) ([]*Check, error) {
+	return readChecks(f, nil)
+}
+
+// readChecksFile reads checks from YAML or .sql file at filePath,
+// taking missing fields from defaults d
+func readChecksFile(filePath string, d defaultsChain) ([]*Check, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	items, err := readFileItems(filePath, b)
+	if err != nil {
+		return nil, inFile(err, filePath)
+	}
+	checks, err := readItemChecks(items, d, filepath.Dir(filePath))
+	if err != nil {
+		return nil, inFile(err, filePath)
+	}
+	return checks, nil
+}
+
+// ReadChecksFile reads checks from YAML or .sql file at filePath
+func ReadChecksFile(filePath string) ([]*Check, error) {
+	return readChecksFile(filePath, nil)
+}
@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadChecks(t *testing.T) {
+	cases := []string{
+		`
+- description: some_table empty
+  query: SELECT id FROM some_table
+  assert: absent
+- description: other_table non-empty
+  query: SELECT id FROM other_table
+  assert: present
+`,
+		`
+description: some_table empty
+query: SELECT id FROM some_table
+assert: absent
+---
+description: other_table non-empty
+query: SELECT id FROM other_table
+assert: present
+---
+`,
+	}
+	expectedChecks := []Check{
+		{Description: "some_table empty", Query: "SELECT id FROM some_table", Assert: "absent"},
+		{Description: "other_table non-empty", Query: "SELECT id FROM other_table", Assert: "present"},
+	}
+	for _, data := range cases {
+		checks, err := ReadChecks(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to read checks: %v", err)
+		}
+		if len(checks) != len(expectedChecks) {
+			t.Fatalf("Expected to read %d checks, got %d", len(expectedChecks), len(checks))
+		}
+		for i, expected := range expectedChecks {
+			if !eqCheck(*checks[i], expected) {
+				t.Errorf("Expected check %v, got %v", expected, *checks[i])
+			}
+		}
+	}
+
+	data := `
+description: some_table empty
+query: SELECT id FROM some_table
+assert: absent
+---
+description: other_table non-empty
+assert: present
+`
+	_, err := ReadChecks(strings.NewReader(data))
+	if err == nil || !strings.HasPrefix(err.Error(), "check #2:") {
+		t.Errorf("Expected error about check #2, got %v", err)
+	}
+}
+
+func TestGetChecksKeepsText(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "_defaults.yml"), []byte("vars:\n  code: 007\n  flag: on\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "settings.yml")
+	data := `
+description: Settings
+query: SELECT enabled, code, ratio, flag FROM settings WHERE code = '${code}'
+assert: equals
+expected:
+  - [NO, 007, 1.50, on]
+vars:
+  flag: off
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checks, err := GetChecks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 {
+		t.Fatalf("Expected single check, got %d", len(checks))
+	}
+	if got := checks[0].Expected[0].Strings(); strings.Join(got, ",") != "NO,007,1.50,on" {
+		t.Errorf("Expected text of values to be kept, got %v", got)
+	}
+	if vars := checks[0].Vars; vars["code"] != "007" || vars["flag"] != "off" {
+		t.Errorf("Expected text of vars to be kept, got %v", vars)
+	}
+}
+
+func TestGetChecksDuplicate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	check := "id: some_table\ndescription: some_table empty\nquery: SELECT id FROM some_table\nassert: absent\n"
+	for _, name := range []string{"first.yml", "second.yml"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(check), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first check wins, the duplicate is skipped
+	checks, err := GetChecks(dir)
+	if err != nil {
+		t.Fatalf("Failed to get checks: %v", err)
+	}
+	if len(checks) != 1 || checks[0].ID != "some_table" {
+		t.Errorf("Expected single check some_table, got %v", checks)
+	}
+
+	// or reported as UNKNOWN in strict mode
+	checks, err = LoadChecks([]string{dir}, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %v", checks)
+	}
+	duplicate := checks[1]
+	expectedID := "some_table@" + filepath.ToSlash(filepath.Join(dir, "second.yml"))
+	if duplicate.ID != expectedID || !strings.Contains(duplicate.LoadError, "duplicate check id") {
+		t.Errorf("Expected broken check %s about duplicate check, got %v", expectedID, *duplicate)
+	}
+}
+
+func TestDeriveCheckID(t *testing.T) {
+	cases := []struct {
+		path     string
+		index    int
+		count    int
+		expected string
+	}{
+		{"checks/billing/invoices.yml", 0, 1, "billing/invoices"},
+		{"checks/billing/invoices.yml", 1, 3, "billing/invoices#2"},
+		{"checks/locks.yaml", 0, 1, "locks"},
+	}
+	for _, c := range cases {
+		if got := deriveCheckID("checks", c.path, c.index, c.count); got != c.expected {
+			t.Errorf("Expected ID %q for %s, got %q", c.expected, c.path, got)
+		}
+	}
+}
+
+func TestReadSQLChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"unpaid.sql": `
+-- description: Unpaid invoices
+-- assert: absent
+-- tags: [billing]
+--   # comments are allowed too
+
+-- invoices are paid in a day
+SELECT id
+FROM invoices
+WHERE NOT paid
+`,
+		"queries/failed.sql": "-- failed payments\nSELECT id FROM payments WHERE failed\n",
+		"failed.yml":         "description: Failed payments\nquery_file: queries/failed.sql\nassert: absent\n",
+		"plain.sql":          "SELECT 1\n",
+		"debug.sql":          "-- Helper query for manual debugging\nSELECT * FROM invoices\n",
+		"lag.sql":            "-- Replication lag check\n-- description: lag\n-- assert: absent\nSELECT 1\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checks, err := LoadChecks([]string{dir}, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	expectedChecks := []Check{
+		{
+			ID:          "failed",
+			Description: "Failed payments",
+			Query:       "-- failed payments\nSELECT id FROM payments WHERE failed",
+			Assert:      "absent",
+		},
+		{
+			ID:          "lag",
+			Description: "Failed to load checks from lag.sql",
+			LoadError:   filepath.Join(dir, "lag.sql") + ":1: leading -- comments are not a valid front-matter with check fields: yaml: mapping values are not allowed in this context",
+		},
+		{
+			ID:          "unpaid",
+			Description: "Unpaid invoices",
+			Query:       "-- invoices are paid in a day\nSELECT id\nFROM invoices\nWHERE NOT paid",
+			Assert:      "absent",
+			Tags:        []string{"billing"},
+		},
+	}
+	if len(checks) != len(expectedChecks) {
+		t.Fatalf("Expected to load %d checks, got %d", len(expectedChecks), len(checks))
+	}
+	for i, expected := range expectedChecks {
+		if !eqCheck(*checks[i], expected) {
+			t.Errorf("Expected check %v, got %v", expected, *checks[i])
+		}
+	}
+
+	cases := map[string]string{
+		"-- description: Unpaid invoices\n-- assert: absent\n-- query: SELECT 1\nSELECT id FROM invoices\n": ":3: 'query' can't be set",
+		"-- description: Unpaid invoices\n-- assert: [absent\nSELECT id FROM invoices\n":                    ":2: leading -- comments are not a valid front-matter with check fields: yaml: ",
+		"\n-- - description: lag\n-- - assert: absent\nSELECT 1\n":                                          ":2: leading -- comments are not a valid front-matter with check fields, expected 'key: value' lines",
+	}
+	for data, expected := range cases {
+		path := filepath.Join(dir, "bad.sql")
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadChecksFile(path); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+
+	path := filepath.Join(dir, "both.yml")
+	data := "description: Failed payments\nquery: SELECT 1\nquery_file: queries/failed.sql\nassert: absent\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadChecksFile(path); err == nil || !strings.Contains(err.Error(), "only one of 'query' and 'query_file'") {
+		t.Errorf("Expected error about both query and query_file, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -9,19 +10,104 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/fractalcat/nagiosplugin"
 	"gopkg.in/yaml.v2"
 )
 
 // Check is a description of check
 type Check struct {
-	Description string `yaml:"description"`
-	Query       string `yaml:"query"`
-	Assert      string `yaml:"assert"`
+	// ID identifies check in reports, derived from file path if not set
+	ID          string        `yaml:"id" json:",omitempty"`
+	Description string        `yaml:"description"`
+	Query       string        `yaml:"query"`
+	Assert      string        `yaml:"assert"`
+	Warning     string        `yaml:"warning" json:",omitempty"`
+	Critical    string        `yaml:"critical" json:",omitempty"`
+	Severity    string        `yaml:"severity" json:",omitempty"`
+	Timeout     time.Duration `yaml:"timeout" json:",omitempty"`
+	Interval    time.Duration `yaml:"interval" json:",omitempty"`
+	Targets     []string      `yaml:"targets" json:",omitempty"`
+	TargetTags  []string      `yaml:"target_tags" json:",omitempty"`
+	// row count bounds for count assertion, nil means no bound
+	MinRows         *int `yaml:"min_rows" json:",omitempty"`
+	MaxRows         *int `yaml:"max_rows" json:",omitempty"`
+	WarningMinRows  *int `yaml:"warning_min_rows" json:",omitempty"`
+	WarningMaxRows  *int `yaml:"warning_max_rows" json:",omitempty"`
+	CriticalMinRows *int `yaml:"critical_min_rows" json:",omitempty"`
+	CriticalMaxRows *int `yaml:"critical_max_rows" json:",omitempty"`
+	// expected output for equals assertion
+	Expected        []Row    `yaml:"expected" json:",omitempty"`
+	ExpectedColumns []string `yaml:"expected_columns" json:",omitempty"`
+	// per-row expression for all, none and any assertions
+	Expression string `yaml:"expression" json:",omitempty"`
+	// variables for ${name} placeholders in description and queries
+	Vars map[string]string `yaml:"vars" json:",omitempty"`
+	// Tags are free-form labels of check
+	Tags []string `yaml:"tags" json:",omitempty"`
+	// reconcile assertion compares query output with compare_query output on compare_target
+	CompareQuery  string   `yaml:"compare_query" json:",omitempty"`
+	CompareTarget string   `yaml:"compare_target" json:",omitempty"`
+	KeyColumns    []string `yaml:"key_columns" json:",omitempty"`
+	Tolerance     float64  `yaml:"tolerance" json:",omitempty"`
+	// LoadError is set for placeholder of check file which failed to load,
+	// such check is never run and always reported as UNKNOWN
+	LoadError string `yaml:"-" json:",omitempty"`
+}
+
+// assertions are names of supported check assertions
+var assertions = []string{
+	"absent", "present", "true", "false", "threshold", "count",
+	"equals", "all", "none", "any", "reconcile",
+}
+
+// isAssertion checks if name is a supported assertion
+func isAssertion(name string) bool {
+	for _, a := range assertions {
+		if a == name {
+			return true
+		}
+	}
+	return false
 }
 
 // CheckFunc is a function we use for checks
-type CheckFunc func(*sql.DB, Check) (*CheckResult, error)
+type CheckFunc func(context.Context, Querier, Check) (*CheckResult, error)
+
+// Querier is a subset of *sql.DB and *sql.Tx methods used by checks
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// RunOptions controls how checks are run
+type RunOptions struct {
+	// Concurrency limits concurrent executions of checks
+	Concurrency int
+	// ProblemState is a state for problems of checks without own severity
+	ProblemState State
+	// Timeout limits execution time of checks without own timeout,
+	// zero means no limit
+	Timeout time.Duration
+	// AllowWrites disables read-only transactions for checks
+	AllowWrites bool
+	// Vars override variables of checks and environment
+	Vars map[string]string
+}
+
+// problemState returns state for check problems based on check severity,
+// defaultState is used when severity is not set
+func (c Check) problemState(defaultState State) State {
+	if c.Severity == "" {
+		return defaultState
+	}
+	state, err := ParseState(c.Severity)
+	if err != nil {
+		return StateUnknown
+	}
+	return state
+}
 
 // ReadCheck reads check from io.Reader
 func ReadCheck(f io.Reader) (*Check, error) {
@@ -34,16 +120,122 @@ func ReadCheck(f io.Reader) (*Check, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// validate checks that Check has all required fields with valid values
+func (c Check) validate() error {
 	if c.Description == "" {
-		return nil, errors.New("not a valid check, 'description' is missing")
+		return errors.New("not a valid check, 'description' is missing")
 	}
 	if c.Query == "" {
-		return nil, errors.New("not a valid check, 'query' is missing")
+		return errors.New("not a valid check, 'query' is missing")
 	}
 	if c.Assert == "" {
-		return nil, errors.New("not a valid check, 'assert' is missing")
+		return errors.New("not a valid check, 'assert' is missing")
+	}
+	if !isAssertion(c.Assert) {
+		return fmt.Errorf("not a valid check, unknown assertion %q, use one of: %s", c.Assert, strings.Join(assertions, ", "))
+	}
+	for _, s := range []string{c.Description, c.Query, c.CompareQuery} {
+		if err := validatePlaceholders(s); err != nil {
+			return fmt.Errorf("not a valid check, %v", err)
+		}
+	}
+	if c.Severity != "" {
+		if _, err := ParseState(c.Severity); err != nil {
+			return fmt.Errorf("not a valid check, bad 'severity': %v", err)
+		}
+	}
+	if c.Assert == "threshold" {
+		if c.Warning == "" && c.Critical == "" {
+			return errors.New("not a valid check, 'warning' or 'critical' is required for threshold assertion")
+		}
+		if _, err := parseRange(c.Warning); err != nil {
+			return fmt.Errorf("not a valid check, bad 'warning' range: %v", err)
+		}
+		if _, err := parseRange(c.Critical); err != nil {
+			return fmt.Errorf("not a valid check, bad 'critical' range: %v", err)
+		}
 	}
-	return &c, err
+	if c.Assert == "count" {
+		if err := c.validateRowBounds(); err != nil {
+			return fmt.Errorf("not a valid check, %v", err)
+		}
+	}
+	if c.Assert == "equals" {
+		if err := c.validateExpected(); err != nil {
+			return fmt.Errorf("not a valid check, %v", err)
+		}
+	}
+	switch c.Assert {
+	case "all", "none", "any":
+		if c.Expression == "" {
+			return fmt.Errorf("not a valid check, 'expression' is required for %s assertion", c.Assert)
+		}
+		if _, err := compileExpression(c.Expression); err != nil {
+			return fmt.Errorf("not a valid check, %v", err)
+		}
+	case "reconcile":
+		if c.CompareTarget == "" {
+			return errors.New("not a valid check, 'compare_target' is required for reconcile assertion")
+		}
+		if c.Tolerance < 0 {
+			return errors.New("not a valid check, 'tolerance' is negative")
+		}
+	}
+	return nil
+}
+
+// validateExpected checks that equals assertion has expected rows of the same width
+func (c Check) validateExpected() error {
+	if c.Expected == nil {
+		return errors.New("'expected' is required for equals assertion")
+	}
+	width := len(c.ExpectedColumns)
+	for i, row := range c.Expected {
+		if width == 0 {
+			width = len(row)
+		}
+		if len(row) != width {
+			return fmt.Errorf("expected row #%d has %d values instead of %d", i+1, len(row), width)
+		}
+	}
+	return nil
+}
+
+// validateRowBounds checks that count assertion has valid row count bounds
+func (c Check) validateRowBounds() error {
+	bounds := []struct {
+		name     string
+		min, max *int
+	}{
+		{"", c.MinRows, c.MaxRows},
+		{"warning_", c.WarningMinRows, c.WarningMaxRows},
+		{"critical_", c.CriticalMinRows, c.CriticalMaxRows},
+	}
+	found := false
+	for _, b := range bounds {
+		if b.min != nil && *b.min < 0 {
+			return fmt.Errorf("'%smin_rows' is negative", b.name)
+		}
+		if b.max != nil && *b.max < 0 {
+			return fmt.Errorf("'%smax_rows' is negative", b.name)
+		}
+		if b.min != nil && b.max != nil && *b.min > *b.max {
+			return fmt.Errorf("'%smin_rows' is greater than '%smax_rows'", b.name, b.name)
+		}
+		if b.min != nil || b.max != nil {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("'min_rows' or 'max_rows' is required for count assertion")
+	}
+	return nil
 }
 
 // ReadCheckFile reads check from file at filePath.
@@ -57,45 +249,68 @@ func ReadCheckFile(filePath string) (*Check, error) {
 }
 
 // CheckQueryAbsent is a checker function that considers any output row a problem
-func CheckQueryAbsent(db *sql.DB, check Check) (*CheckResult, error) {
-	var results []Row
-
-	rows, err := db.Query(check.Query)
+func CheckQueryAbsent(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+	rows, err := db.QueryContext(ctx, check.Query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	cols, err := rows.Columns()
+	cols, results, _, err := scanRows(rows, 0)
 	if err != nil {
 		return nil, err
 	}
-	rawResult := make([][]byte, len(cols))
+	return &CheckResult{Check: check, Problems: results, Columns: cols}, nil
+}
 
-	fields := make([]interface{}, len(cols)) // A temporary interface{} slice
-	for i := range rawResult {
-		fields[i] = &rawResult[i] // Put pointers to each string in the interface slice
+// sampleRows limits number of rows shown by count check
+const sampleRows = 10
+
+// rowCountViolation returns problem message if count is out of bounds,
+// or empty string if it is not
+func rowCountViolation(count int, min, max *int) string {
+	switch {
+	case min != nil && count < *min:
+		return fmt.Sprintf("Returned %d rows, expected at least %d", count, *min)
+	case max != nil && count > *max:
+		return fmt.Sprintf("Returned %d rows, expected at most %d", count, *max)
 	}
-	for rows.Next() {
-		err = rows.Scan(fields...)
-		if err != nil {
-			Error.Println(err)
-			continue
-		}
-		results = append(results, NewRow(fields))
+	return ""
+}
 
+// CheckQueryCount is a checker function that checks number of output rows
+// against min_rows and max_rows bounds, showing sample of rows on failure
+func CheckQueryCount(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+	rows, err := db.QueryContext(ctx, check.Query)
+	if err != nil {
+		return nil, err
 	}
-	err = rows.Err() // Get any error encountered during iteration
+	defer rows.Close()
+	cols, sample, count, err := scanRows(rows, sampleRows)
 	if err != nil {
 		return nil, err
 	}
-	return &CheckResult{Check: check, Problems: results, Columns: cols}, nil
+	result := &CheckResult{Check: check}
+	if msg := rowCountViolation(count, check.CriticalMinRows, check.CriticalMaxRows); msg != "" {
+		result.Message = msg
+		result.State = StateCritical
+	} else if msg := rowCountViolation(count, check.WarningMinRows, check.WarningMaxRows); msg != "" {
+		result.Message = msg
+		result.State = StateWarning
+	} else if msg := rowCountViolation(count, check.MinRows, check.MaxRows); msg != "" {
+		result.Message = msg
+	}
+	if result.Message != "" && count > 0 {
+		result.Columns = cols
+		result.Problems = sample
+	}
+	return result, nil
 }
 
 // CheckQueryPresent is a checker function that considers missing output a problem
-func CheckQueryPresent(db *sql.DB, check Check) (*CheckResult, error) {
+func CheckQueryPresent(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
 	var results []Row
 
-	rows, err := db.Query(check.Query)
+	rows, err := db.QueryContext(ctx, check.Query)
 	if err != nil {
 		return nil, err
 	}
@@ -105,20 +320,20 @@ func CheckQueryPresent(db *sql.DB, check Check) (*CheckResult, error) {
 		return nil, err
 	}
 	if !rows.Next() {
-		results = append(results, Row{"No results found"})
+		results = append(results, TextRow("No results found"))
 	}
 
 	return &CheckResult{Check: check, Problems: results}, nil
 }
 
 // CheckQueryBool is a checker function that checks boolean output
-func CheckQueryBool(db *sql.DB, check Check, waitFor bool) (*CheckResult, error) {
+func CheckQueryBool(ctx context.Context, db Querier, check Check, waitFor bool) (*CheckResult, error) {
 	var results []Row
 	var output bool
-	err := db.QueryRow(check.Query).Scan(&output)
+	err := db.QueryRowContext(ctx, check.Query).Scan(&output)
 	switch {
 	case err == sql.ErrNoRows:
-		results = append(results, Row{"No rows for boolean check"})
+		results = append(results, TextRow("No rows for boolean check"))
 		return &CheckResult{Check: check, Problems: results}, nil
 	case err != nil:
 		return nil, err
@@ -126,55 +341,401 @@ func CheckQueryBool(db *sql.DB, check Check, waitFor bool) (*CheckResult, error)
 		if output != waitFor {
 			results = append(
 				results,
-				Row{
-					fmt.Sprintf("Expected %v, got %v", waitFor, output),
-				},
+				TextRow(fmt.Sprintf("Expected %v, got %v", waitFor, output)),
 			)
 		}
 		return &CheckResult{Check: check, Problems: results}, nil
 	}
 }
 
-// GetChecks scans filesystem under searchDir and returns list of checks
-func GetChecks(searchDir string) ([]*Check, error) {
-	var results []*Check
+// CheckQueryEquals is a checker function that compares output rows
+// with expected rows in any order, and output columns with expected columns if they are set
+func CheckQueryEquals(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+	rows, err := db.QueryContext(ctx, check.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, results, _, err := scanRows(rows, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Check: check}
+	var messages []string
+	if check.ExpectedColumns != nil && !eqStrings(cols, check.ExpectedColumns) {
+		messages = append(messages, fmt.Sprintf("Expected columns %s, got %s",
+			strings.Join(check.ExpectedColumns, ", "), strings.Join(cols, ", ")))
+	}
+	missing := DiffRows(results, check.Expected)
+	unexpected := DiffRows(check.Expected, results)
+	if len(missing) > 0 || len(unexpected) > 0 {
+		messages = append(messages, fmt.Sprintf("Expected rows differ, %d missing, %d unexpected",
+			len(missing), len(unexpected)))
+		result.Columns = append([]string{"diff"}, cols...)
+		for _, row := range missing {
+			result.Problems = append(result.Problems, append(TextRow("missing"), row...))
+		}
+		for _, row := range unexpected {
+			result.Problems = append(result.Problems, append(TextRow("unexpected"), row...))
+		}
+	}
+	result.Message = strings.Join(messages, "; ")
+	return result, nil
+}
 
-	stat, err := os.Stat(searchDir)
+// CheckQueryExpression is a checker function that evaluates check expression against
+// each output row. For all assertion rows not matching expression are problems,
+// for none assertion matching rows are problems, and any assertion requires
+// at least one matching row.
+func CheckQueryExpression(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+	expr, err := compileExpression(check.Expression)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, check.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, results, _, err := scanRows(rows, 0)
 	if err != nil {
 		return nil, err
 	}
+	result := &CheckResult{Check: check}
+	matched := 0
+	for _, row := range results {
+		ok, err := expr.match(cols, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched++
+		}
+		if (check.Assert == "all" && !ok) || (check.Assert == "none" && ok) {
+			result.Problems = append(result.Problems, row)
+		}
+	}
+	if check.Assert == "any" && matched == 0 {
+		result.Message = fmt.Sprintf("None of %d rows match %s", len(results), check.Expression)
+	}
+	if len(result.Problems) > 0 {
+		result.Columns = cols
+	}
+	return result, nil
+}
 
-	if !stat.IsDir() {
-		return nil, fmt.Errorf("No a directory: %s", searchDir)
+// parseRange parses Nagios range, returns nil Range for empty string
+func parseRange(r string) (*nagiosplugin.Range, error) {
+	if strings.TrimSpace(r) == "" {
+		return nil, nil
 	}
+	return nagiosplugin.ParseRange(r)
+}
 
-	err = filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
-		ext := strings.ToLower(filepath.Ext(f.Name()))
-		if ext == ".yaml" || ext == ".yml" {
-			check, err := ReadCheckFile(path)
-			if err != nil {
-				Error.Printf("Failed to read check %s: %v", f.Name(), err)
-				return nil
+// CheckQueryThreshold is a checker function that compares single numeric output
+// against warning and critical Nagios ranges
+func CheckQueryThreshold(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+	var results []Row
+	var value sql.NullFloat64
+	warning, err := parseRange(check.Warning)
+	if err != nil {
+		return nil, err
+	}
+	critical, err := parseRange(check.Critical)
+	if err != nil {
+		return nil, err
+	}
+	err = db.QueryRowContext(ctx, check.Query).Scan(&value)
+	switch {
+	case err == sql.ErrNoRows:
+		results = append(results, TextRow("No rows for threshold check"))
+		return &CheckResult{Check: check, Problems: results, State: StateUnknown}, nil
+	case err != nil:
+		return nil, err
+	case !value.Valid:
+		results = append(results, TextRow("NULL value for threshold check"))
+		return &CheckResult{Check: check, Problems: results, State: StateUnknown}, nil
+	}
+	output := value.Float64
+	state := StateOK
+	switch {
+	case critical != nil && critical.Check(output):
+		state = StateCritical
+		results = append(results, TextRow(
+			fmt.Sprintf("Value %v violates critical threshold %s", output, check.Critical),
+		))
+	case warning != nil && warning.Check(output):
+		state = StateWarning
+		results = append(results, TextRow(
+			fmt.Sprintf("Value %v violates warning threshold %s", output, check.Warning),
+		))
+	}
+	return &CheckResult{Check: check, Problems: results, State: state}, nil
+}
+
+// duplicateCheck returns placeholder for check with id from path which is already used,
+// ID of placeholder is made unique by path
+func duplicateCheck(id, path string, err error) *Check {
+	return &Check{
+		ID:          fmt.Sprintf("%s@%s", id, filepath.ToSlash(path)),
+		Description: fmt.Sprintf("Failed to load check %s from %s", id, filepath.ToSlash(path)),
+		LoadError:   err.Error(),
+	}
+}
+
+// brokenCheck returns placeholder for file at path in source root which failed to load with err
+func brokenCheck(root, path string, err error) *Check {
+	rel, relErr := filepath.Rel(root, path)
+	if relErr != nil {
+		rel = path
+	}
+	return &Check{
+		ID:          deriveCheckID(root, path, 0, 1),
+		Description: fmt.Sprintf("Failed to load checks from %s", filepath.ToSlash(rel)),
+		LoadError:   err.Error(),
+	}
+}
+
+// LoadChecks reads checks from sources, which are directories or single files,
+// and returns list of checks sorted by path of their files, followed by checks from databases.
+// Files and rows which fail to load are returned as broken checks in strict mode,
+// and so are checks with ID already used by other check, like checks derived
+// from files with the same name in different sources. Broken .sql files come after
+// other files, as they are skipped if they are query files of other checks.
+func LoadChecks(sources []string, opts LoadOptions) ([]*Check, error) {
+	var results []*Check
+
+	// files of checks by their IDs
+	seen := make(map[string]string)
+	add := func(path string, checks []*Check) {
+		for _, check := range checks {
+			if other, ok := seen[check.ID]; ok {
+				err := fmt.Errorf("duplicate check id %q, also in %s", check.ID, other)
+				if !opts.Strict {
+					Error.Printf("Failed to read checks: %s: %v", path, err)
+					continue
+				}
+				check = duplicateCheck(check.ID, path, err)
+				if _, ok := seen[check.ID]; ok {
+					// duplicate in the same file is already reported
+					continue
+				}
 			}
+			seen[check.ID] = path
 			results = append(results, check)
 		}
+	}
+	onError := func(root, path string, err error) {
+		if !opts.Strict {
+			Error.Printf("Failed to read checks: %v", err)
+			return
+		}
+		add(path, []*Check{brokenCheck(root, path, err)})
+	}
+	err := walkCheckFiles(sources, opts, onError, func(f checkFile, d defaultsChain) error {
+		if isDefaultsFile(f.path) {
+			return nil
+		}
+		checks, err := readChecksFile(f.path, d)
+		if err != nil {
+			onError(f.root, f.path, err)
+			return nil
+		}
+		for i, check := range checks {
+			if check.ID == "" {
+				check.ID = deriveCheckID(f.root, f.path, i, len(checks))
+			}
+		}
+		add(f.path, checks)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	for _, source := range opts.Databases {
+		checks, err := loadDBChecks(source, opts.Timeout, func(id string, n int, err error) {
+			if !opts.Strict {
+				Error.Printf("Failed to read checks: %s, row %d: %v", source, n, err)
+				return
+			}
+			add(source.String(), []*Check{brokenDBCheck(source, id, n, err)})
+		})
+		if err != nil && opts.Strict {
+			checks = []*Check{brokenDBCheck(source, "", 0, err)}
+		} else if err != nil {
+			Error.Printf("Failed to read checks: %s: %v", source, err)
+		}
+		add(source.String(), checks)
+	}
 	return results, nil
 }
 
-// RunChecks runs all check, uses dbConnString for db connection
-func RunChecks(dbType, dbConnString string, checks []*Check, concurrency int) ([]CheckResult, error) {
-	db, err := sql.Open(dbType, dbConnString)
+// GetChecks scans filesystem under searchDir and returns list of checks,
+// files which fail to load are logged and skipped
+func GetChecks(searchDir string) ([]*Check, error) {
+	stat, err := os.Stat(searchDir)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	return runChecks(db, checks, concurrency)
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("No a directory: %s", searchDir)
+	}
+	return LoadChecks([]string{searchDir}, LoadOptions{})
+}
+
+// deriveCheckID returns ID for check without one based on path of its file
+// relative to searchDir without extension, like team/service/check.
+// Position of check is appended for files with several checks, like team/service/checks#2.
+func deriveCheckID(searchDir, path string, index, count int) string {
+	rel, err := filepath.Rel(searchDir, path)
+	if err != nil {
+		rel = path
+	}
+	id := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+	if count > 1 {
+		id = fmt.Sprintf("%s#%d", id, index+1)
+	}
+	return id
+}
+
+// RunChecks runs all checks against all targets they apply to.
+// Results with problems but without own state get check severity,
+// or opts.ProblemState if check has no severity.
+func RunChecks(targets []Target, checks []*Check, opts RunOptions) ([]CheckResult, error) {
+	conns, err := openConnections(targets)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnections(conns)
+
+	return runJobs(makeJobs(conns, checks), opts), nil
+}
+
+// connection is a connection pool to Target
+type connection struct {
+	target Target
+	driver *Driver
+	db     *sql.DB
+	// err is an error of getting connection string for Target
+	err error
+}
+
+// openConnections opens connection pools to all targets
+func openConnections(targets []Target) ([]*connection, error) {
+	var conns []*connection
+	for _, t := range targets {
+		conn := &connection{target: t}
+		conns = append(conns, conn)
+		conn.driver, conn.err = GetDriver(t.Type)
+		if conn.err != nil {
+			continue
+		}
+		dbConnString, err := t.ConnString()
+		if err != nil {
+			conn.err = err
+			continue
+		}
+		conn.db, err = sql.Open(conn.driver.SQLDriver, dbConnString)
+		if err != nil {
+			closeConnections(conns)
+			return nil, err
+		}
+	}
+	return conns, nil
+}
+
+// closeConnections closes all opened connection pools
+func closeConnections(conns []*connection) {
+	for _, conn := range conns {
+		if conn.db != nil {
+			conn.db.Close()
+		}
+	}
+}
+
+// appliesTo checks if Check should be run against Target.
+// Check without targets and target tags applies to all targets
+// except its compare target.
+func (c Check) appliesTo(t Target) bool {
+	if c.CompareTarget != "" && c.CompareTarget == t.Name {
+		// reconciliation of target with itself makes no sense
+		return false
+	}
+	if len(c.Targets) == 0 && len(c.TargetTags) == 0 {
+		return true
+	}
+	for _, name := range c.Targets {
+		if name == t.Name {
+			return true
+		}
+	}
+	return t.hasTag(c.TargetTags)
+}
+
+// job is a check to run against some connection
+type job struct {
+	check *Check
+	// conn is nil for check which applies to no targets
+	conn *connection
+	// compare is a connection to compare target of reconcile check,
+	// nil if check has no compare target or it is not found
+	compare *connection
+}
+
+// makeJobs fans out checks across connections they apply to
+func makeJobs(conns []*connection, checks []*Check) []job {
+	var jobs []job
+	for _, c := range checks {
+		if c.LoadError != "" {
+			jobs = append(jobs, job{check: c})
+			continue
+		}
+		var compare *connection
+		for _, conn := range conns {
+			if c.CompareTarget != "" && conn.target.Name == c.CompareTarget {
+				compare = conn
+			}
+		}
+		found := false
+		for _, conn := range conns {
+			if c.appliesTo(conn.target) {
+				jobs = append(jobs, job{check: c, conn: conn, compare: compare})
+				found = true
+			}
+		}
+		if !found {
+			jobs = append(jobs, job{check: c})
+		}
+	}
+	return jobs
+}
+
+// reconcileCheckFunc returns checker which runs compare query
+// against job compare target in its own transaction
+func reconcileCheckFunc(j job, opts RunOptions) CheckFunc {
+	name, compareName := j.conn.target.String(), j.compare.target.String()
+	compareQuery := j.check.CompareQuery
+	if compareQuery == "" {
+		compareQuery = j.check.Query
+	}
+	return func(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+		// compare query placeholders depend on compare target driver
+		query, compareArgs, err := j.check.bindQuery(compareQuery, j.compare.driver, opts.Vars)
+		if err != nil {
+			return nil, err
+		}
+		compareChecker := func(ctx context.Context, compareDB Querier, check Check) (*CheckResult, error) {
+			bound := check
+			bound.CompareQuery = query
+			cr, err := CheckQueryReconcile(ctx, db, bindArgs(compareDB, compareArgs), bound, name, compareName)
+			if cr != nil {
+				cr.Check = check
+			}
+			return cr, err
+		}
+		return runInTx(ctx, j.compare.db, j.compare.driver, compareChecker, check, opts.AllowWrites)
+	}
 }
 
 func getCheckFunc(c *Check) CheckFunc {
@@ -184,21 +745,100 @@ func getCheckFunc(c *Check) CheckFunc {
 	case "present":
 		return CheckQueryPresent
 	case "true":
-		return func(db *sql.DB, check Check) (*CheckResult, error) {
-			return CheckQueryBool(db, check, true)
+		return func(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+			return CheckQueryBool(ctx, db, check, true)
 		}
 	case "false":
-		return func(db *sql.DB, check Check) (*CheckResult, error) {
-			return CheckQueryBool(db, check, false)
+		return func(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+			return CheckQueryBool(ctx, db, check, false)
 		}
+	case "threshold":
+		return CheckQueryThreshold
+	case "count":
+		return CheckQueryCount
+	case "equals":
+		return CheckQueryEquals
+	case "all", "none", "any":
+		return CheckQueryExpression
 	default:
 		return nil
 	}
 }
 
-// runChecks runs all checks, uses db object
-func runChecks(db *sql.DB, checks []*Check, concurrency int) ([]CheckResult, error) {
+// runCheck runs single job
+func runCheck(j job, opts RunOptions) *CheckResult {
+	var cr *CheckResult
+	switch {
+	case j.check.LoadError != "":
+		cr = FailedCheck(j.check, j.check.LoadError)
+		cr.State = StateUnknown
+	case j.conn == nil:
+		cr = FailedCheck(j.check, "Check applies to no targets")
+	case j.conn.err != nil:
+		cr = FailedCheck(j.check, fmt.Sprintf("Failed to connect to target: %v", j.conn.err))
+		cr.Target = j.conn.target.Name
+	case j.check.CompareTarget != "" && j.compare == nil:
+		cr = FailedCheck(j.check, fmt.Sprintf("Compare target %s not found", j.check.CompareTarget))
+		cr.Target = j.conn.target.Name
+	case j.compare != nil && j.compare.err != nil:
+		cr = FailedCheck(j.check, fmt.Sprintf("Failed to connect to compare target: %v", j.compare.err))
+		cr.Target = j.conn.target.Name
+	default:
+		cr = performCheck(j, opts)
+		cr.Target = j.conn.target.Name
+	}
+	if cr.State == StateOK && cr.HasProblems() {
+		cr.State = cr.Check.problemState(opts.ProblemState)
+	}
+	return cr
+}
+
+// performCheck runs job check with appropriate checker and timeout
+func performCheck(j job, opts RunOptions) *CheckResult {
+	c := j.check
+	checker := getCheckFunc(c)
+	if c.Assert == "reconcile" && j.compare != nil {
+		checker = reconcileCheckFunc(j, opts)
+	}
+	if checker == nil {
+		return FailedCheck(c, fmt.Sprintf("Unknown check assertion %s", c.Assert))
+	}
+	rendered, args, err := renderCheck(*c, j.conn.driver, opts.Vars)
+	if err != nil {
+		// missing variable is a configuration error, not a problem in data
+		cr := FailedCheck(c, fmt.Sprintf("Failed to substitute check variables: %v", err))
+		cr.State = StateUnknown
+		return cr
+	}
+	c = &rendered
+	ctx := context.Background()
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = opts.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	cr, err := runInTx(ctx, j.conn.db, j.conn.driver, withArgs(checker, args), *c, opts.AllowWrites)
+	duration := time.Since(start)
+	switch {
+	case err != nil && ctx.Err() == context.DeadlineExceeded:
+		cr = FailedCheck(c, fmt.Sprintf("Check timed out after %v", duration))
+		cr.State = StateUnknown
+	case err != nil:
+		cr = FailedCheck(c, fmt.Sprintf("Error while running check: %v", err))
+	}
+	cr.Duration = duration
+	return cr
+}
+
+// runJobs runs all jobs concurrently
+func runJobs(jobs []job, opts RunOptions) []CheckResult {
 	var results []CheckResult
+	concurrency := opts.Concurrency
 	if concurrency < 1 {
 		concurrency = 1
 	}
@@ -210,32 +850,20 @@ func runChecks(db *sql.DB, checks []*Check, concurrency int) ([]CheckResult, err
 	sem := make(chan bool, concurrency)
 	defer close(sem)
 	// iterating is less error-prone and helps DRY
-	for _, check := range checks {
+	for _, j := range jobs {
 		// spawn goroutine
-		go func(c *Check) {
-			var checker CheckFunc
+		go func(j job) {
 			// Try to get semaphore. If it is full, we'll block until some other goroutine will end
 			sem <- true
 			// defer releasing of semaphore
 			defer func() { <-sem }()
-			checker = getCheckFunc(c)
-			if checker == nil {
-				ch <- FailedCheck(c, fmt.Sprintf("Unknown check assertion %s", c.Assert))
-				return
-			}
-			// perform check
-			cr, err := checker(db, *c)
-			if err != nil {
-				ch <- FailedCheck(c, fmt.Sprintf("Error while running check: %v", err))
-				return
-			}
-			// send result to channel
-			ch <- cr
-		}(check)
+			// perform check and send result to channel
+			ch <- runCheck(j, opts)
+		}(j)
 	}
 
 	// get the results
-	for range checks {
+	for range jobs {
 		cr := <-ch
 		results = append(results, *cr)
 	}
@@ -243,5 +871,5 @@ func runChecks(db *sql.DB, checks []*Check, concurrency int) ([]CheckResult, err
 	for i := 0; i < cap(sem); i++ {
 		sem <- true
 	}
-	return results, nil
+	return results
 }
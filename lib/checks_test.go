@@ -1,8 +1,14 @@
 package lib
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
@@ -36,7 +42,7 @@ assert: present
 		Assert:      "present",
 	}
 
-	if *gotCheck != expectedCheck {
+	if !eqCheck(*gotCheck, expectedCheck) {
 		t.Errorf("Got check %v not equal to expected %v", gotCheck, expectedCheck)
 	}
 }
@@ -60,7 +66,7 @@ func TestQueryPresentOk(t *testing.T) {
 	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
 		WillReturnRows(sqlmock.NewRows(columns).FromCSVString("1, OK"))
 
-	result, err := CheckQueryPresent(db, check)
+	result, err := CheckQueryPresent(context.Background(), db, check)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
@@ -100,7 +106,7 @@ func TestQueryPresentBad(t *testing.T) {
 	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
 		WillReturnRows(sqlmock.NewRows(columns))
 
-	result, err := CheckQueryPresent(db, check)
+	result, err := CheckQueryPresent(context.Background(), db, check)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
@@ -108,7 +114,7 @@ func TestQueryPresentBad(t *testing.T) {
 	expectedResult := CheckResult{
 		Check: check,
 		Problems: []Row{
-			{"No results found"},
+			TextRow("No results found"),
 		},
 	}
 
@@ -140,7 +146,7 @@ func TestQueryAbsentOk(t *testing.T) {
 	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
 		WillReturnRows(sqlmock.NewRows(columns))
 
-	result, err := CheckQueryAbsent(db, check)
+	result, err := CheckQueryAbsent(context.Background(), db, check)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
@@ -179,16 +185,16 @@ func TestQueryAbsentBad(t *testing.T) {
 	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
 		WillReturnRows(sqlmock.NewRows(columns).FromCSVString("1, OK"))
 
-	result, err := CheckQueryAbsent(db, check)
+	result, err := CheckQueryAbsent(context.Background(), db, check)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
 
 	expectedResult := CheckResult{
 		Check:   check,
-		Columns: Row{"id", "some_col"},
+		Columns: []string{"id", "some_col"},
 		Problems: []Row{
-			{"1", "OK"},
+			TextRow("1", "OK"),
 		},
 	}
 
@@ -218,6 +224,7 @@ func TestGetChecks(t *testing.T) {
 	}
 
 	expectedCheck := Check{
+		ID:          "other_folder/check",
 		Description: "some_table empty",
 		Query:       "SELECT id, some_col FROM some_table",
 		Assert:      "absent",
@@ -228,11 +235,133 @@ func TestGetChecks(t *testing.T) {
 		t.Errorf("Expected to find %d check, found %d", expectedLen, len(checks))
 	}
 
-	if *checks[0] != expectedCheck {
+	if !eqCheck(*checks[0], expectedCheck) {
 		t.Errorf("Expected check to be equal to %v, found %v", expectedCheck, *checks[0])
 	}
 }
 
+func TestGetChecksDefaults(t *testing.T) {
+	testPath := "./test_data_defaults/"
+
+	checks, err := GetChecks(testPath)
+	if err != nil {
+		t.Fatalf("Failed to get checks from path %s: %v", testPath, err)
+	}
+
+	expectedChecks := []Check{
+		{
+			ID:          "billing/invoices/unpaid",
+			Description: "Unpaid invoices",
+			Query:       "SELECT id FROM ${schema:ident}.invoices WHERE NOT paid AND created < now() - ${max_age}::interval",
+			Assert:      "absent",
+			Severity:    "warning",
+			Timeout:     10 * time.Second,
+			TargetTags:  []string{"replica"},
+			Tags:        []string{"billing"},
+			Vars:        map[string]string{"schema": "billing", "max_age": "1 day"},
+		},
+		{
+			ID:          "payments",
+			Description: "Failed payments",
+			Query:       "SELECT id FROM ${schema:ident}.payments WHERE failed",
+			Assert:      "absent",
+			Severity:    "critical",
+			Timeout:     5 * time.Second,
+			Tags:        []string{"billing"},
+			Vars:        map[string]string{"schema": "payments", "max_age": "1 hour"},
+		},
+	}
+	if len(checks) != len(expectedChecks) {
+		t.Fatalf("Expected to find %d checks, found %d", len(expectedChecks), len(checks))
+	}
+	for i, expected := range expectedChecks {
+		if !eqCheck(*checks[i], expected) {
+			t.Errorf("Expected check to be equal to %v, found %v", expected, *checks[i])
+		}
+	}
+}
+
+func TestReadDefaultsForbiddenKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "_defaults.yaml")
+	for _, key := range []string{"id", "description", "query", "query_file"} {
+		data := fmt.Sprintf("severity: critical\n%s: x\n", key)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readDefaults(dir)
+		expected := fmt.Sprintf("%s:2: '%s' can't have default value", path, key)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestLoadChecksStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "billing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"good.yml":               "description: some_table empty\nquery: SELECT id FROM some_table\nassert: absent\n",
+		"typo.yml":               "description: other_table empty\nqeury: SELECT id FROM other_table\nassert: absent\n",
+		"billing/_defaults.yaml": "severity: [critical\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checks, err := LoadChecks([]string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	if len(checks) != 1 || checks[0].ID != "good" {
+		t.Errorf("Expected to load only good check, got %v", checks)
+	}
+
+	checks, err = LoadChecks([]string{dir}, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	expected := []struct {
+		id, description string
+	}{
+		{"billing/_defaults", "Failed to load checks from billing/_defaults.yaml"},
+		{"good", "some_table empty"},
+		{"typo", "Failed to load checks from typo.yml"},
+	}
+	if len(checks) != len(expected) {
+		t.Fatalf("Expected to load %d checks, got %v", len(expected), checks)
+	}
+	for i, e := range expected {
+		if checks[i].ID != e.id || checks[i].Description != e.description {
+			t.Errorf("Expected check %s with description %q, got %v", e.id, e.description, *checks[i])
+		}
+	}
+	if !strings.Contains(checks[2].LoadError, "'query' is missing") {
+		t.Errorf("Expected load error about missing query, got %q", checks[2].LoadError)
+	}
+
+	results, err := RunChecks([]Target{{Name: "db1", Type: "postgres"}}, checks[2:], RunOptions{ProblemState: StateWarning})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	if len(results) != 1 || results[0].State != StateUnknown || results[0].Target != "" ||
+		len(results[0].Problems) != 1 || results[0].Problems[0].String() != checks[2].LoadError {
+		t.Errorf("Expected single UNKNOWN result with load error, got %v", results)
+	}
+}
+
 func TestRunChecks(t *testing.T) {
 	// open database stub
 	db, mock, err := sqlmock.New()
@@ -252,34 +381,39 @@ func TestRunChecks(t *testing.T) {
 			Description: "other_table non-empty",
 			Query:       "SELECT id, other_col FROM other_table",
 			Assert:      "present",
+			Severity:    "critical",
 		},
 	}
 	columns1 := []string{"id", "some_col"}
 	columns2 := []string{"id", "other_col"}
-	// match query it with regexp
+	// match query it with regexp, each check runs in own transaction
+	mock.ExpectBegin()
 	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
 		WillReturnRows(sqlmock.NewRows(columns1).FromCSVString("1, OK"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
 	mock.ExpectQuery(`SELECT id, other_col FROM other_table`).
 		WillReturnRows(sqlmock.NewRows(columns2))
+	mock.ExpectRollback()
 
-	result, err := runChecks(db, checks, 1)
-	if err != nil {
-		t.Fatalf("Expected no error, but got %s instead", err)
-	}
+	conns := []*connection{{db: db}}
+	result := runJobs(makeJobs(conns, checks), RunOptions{Concurrency: 1, ProblemState: StateWarning})
 
 	expectedResult := []CheckResult{
 		{
 			Check:   *checks[0],
-			Columns: Row{"id", "some_col"},
+			Columns: []string{"id", "some_col"},
 			Problems: []Row{
-				{"1", "OK"},
+				TextRow("1", "OK"),
 			},
+			State: StateWarning,
 		},
 		{
 			Check: *checks[1],
 			Problems: []Row{
-				{"No results found"},
+				TextRow("No results found"),
 			},
+			State: StateCritical,
 		},
 	}
 
@@ -318,7 +452,7 @@ func TestCheckQueryBool(t *testing.T) {
 	mock.ExpectQuery(`SELECT.+`).
 		WillReturnRows(sqlmock.NewRows(columns).FromCSVString("t"))
 
-	result, err := CheckQueryBool(db, check, true)
+	result, err := CheckQueryBool(context.Background(), db, check, true)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
@@ -357,14 +491,14 @@ func TestCheckQueryBoolEmpty(t *testing.T) {
 	mock.ExpectQuery(`SELECT.+`).
 		WillReturnRows(sqlmock.NewRows(columns))
 
-	result, err := CheckQueryBool(db, check, false)
+	result, err := CheckQueryBool(context.Background(), db, check, false)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s instead", err)
 	}
 	expectedResult := CheckResult{
 		Check: check,
 		Problems: []Row{
-			{"No rows for boolean check"},
+			TextRow("No rows for boolean check"),
 		},
 	}
 
@@ -377,3 +511,683 @@ func TestCheckQueryBoolEmpty(t *testing.T) {
 		t.Errorf("Expected result to have expected problems %v, got %v", *result, expectedResult)
 	}
 }
+
+func TestReadCheckOptionalFields(t *testing.T) {
+	data := `
+description: Some description
+query: SELECT * FROM some_table
+assert: absent
+severity: critical
+timeout: 5s
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	if gotCheck.Severity != "critical" {
+		t.Errorf("Expected check severity to be critical, got %v", gotCheck.Severity)
+	}
+	if gotCheck.Timeout != 5*time.Second {
+		t.Errorf("Expected check timeout to be 5s, got %v", gotCheck.Timeout)
+	}
+
+	data = `
+description: Some description
+query: SELECT * FROM some_table
+assert: absent
+severity: fatal
+`
+	if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+		t.Error("Expected to fail to read check with bad severity")
+	}
+}
+
+func TestReadCheckThreshold(t *testing.T) {
+	data := `
+description: Too many connections
+query: SELECT count(*) FROM pg_stat_activity
+assert: threshold
+warning: "~:50"
+critical: "~:100"
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	expectedCheck := Check{
+		Description: "Too many connections",
+		Query:       "SELECT count(*) FROM pg_stat_activity",
+		Assert:      "threshold",
+		Warning:     "~:50",
+		Critical:    "~:100",
+	}
+	if !eqCheck(*gotCheck, expectedCheck) {
+		t.Errorf("Got check %v not equal to expected %v", gotCheck, expectedCheck)
+	}
+
+	bad := []string{
+		`
+description: No thresholds
+query: SELECT 1
+assert: threshold
+`,
+		`
+description: Bad threshold
+query: SELECT 1
+assert: threshold
+warning: "abc:"
+`,
+	}
+	for _, data := range bad {
+		if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected to fail to read bad threshold check %s", data)
+		}
+	}
+}
+
+func TestCheckQueryThreshold(t *testing.T) {
+	check := Check{
+		Description: "Too many connections",
+		Query:       "SELECT count(*) FROM pg_stat_activity",
+		Assert:      "threshold",
+		Warning:     "~:50",
+		Critical:    "@100:",
+	}
+	cases := []struct {
+		value    string
+		state    State
+		problems int
+	}{
+		{"10", StateOK, 0},
+		{"75", StateWarning, 1},
+		{"150", StateCritical, 1},
+	}
+	for _, c := range cases {
+		// open database stub
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		mock.ExpectQuery(`SELECT.+`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).FromCSVString(c.value))
+		result, err := CheckQueryThreshold(context.Background(), db, check)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s instead", err)
+		}
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expections: %s", err)
+		}
+		if result.State != c.state {
+			t.Errorf("Expected state %v for value %s, got %v", c.state, c.value, result.State)
+		}
+		if len(result.Problems) != c.problems {
+			t.Errorf("Expected len of problems %v for value %s, got %v", c.problems, c.value, len(result.Problems))
+		}
+		db.Close()
+	}
+}
+
+func TestCheckQueryThresholdEmpty(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	check := Check{
+		Description: "Too many connections",
+		Query:       "SELECT count(*) FROM pg_stat_activity",
+		Assert:      "threshold",
+		Critical:    "~:100",
+	}
+	mock.ExpectQuery(`SELECT.+`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}))
+	result, err := CheckQueryThreshold(context.Background(), db, check)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	expectedResult := CheckResult{
+		Check: check,
+		Problems: []Row{
+			TextRow("No rows for threshold check"),
+		},
+		State: StateUnknown,
+	}
+	if !eqResult(*result, expectedResult) {
+		t.Errorf("Expected result to have expected problems %v, got %v", *result, expectedResult)
+	}
+}
+
+func TestCheckQueryThresholdNull(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	check := Check{
+		Description: "Replication lag",
+		Query:       "SELECT max(lag) FROM replicas",
+		Assert:      "threshold",
+		Critical:    "~:100",
+	}
+	mock.ExpectQuery(`SELECT.+`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	result, err := CheckQueryThreshold(context.Background(), db, check)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	expectedResult := CheckResult{
+		Check: check,
+		Problems: []Row{
+			TextRow("NULL value for threshold check"),
+		},
+		State: StateUnknown,
+	}
+	if !eqResult(*result, expectedResult) {
+		t.Errorf("Expected result to have expected problems %v, got %v", *result, expectedResult)
+	}
+}
+
+func TestReadCheckCount(t *testing.T) {
+	data := `
+description: Active workers
+query: SELECT id FROM workers WHERE active
+assert: count
+min_rows: 3
+critical_min_rows: 1
+max_rows: 100
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	one, three, hundred := 1, 3, 100
+	expectedCheck := Check{
+		Description:     "Active workers",
+		Query:           "SELECT id FROM workers WHERE active",
+		Assert:          "count",
+		MinRows:         &three,
+		MaxRows:         &hundred,
+		CriticalMinRows: &one,
+	}
+	if !eqCheck(*gotCheck, expectedCheck) {
+		t.Errorf("Got check %v not equal to expected %v", gotCheck, expectedCheck)
+	}
+
+	bad := []string{
+		`
+description: No bounds
+query: SELECT 1
+assert: count
+`,
+		`
+description: Negative bound
+query: SELECT 1
+assert: count
+warning_max_rows: -1
+`,
+		`
+description: Empty range
+query: SELECT 1
+assert: count
+min_rows: 10
+max_rows: 5
+`,
+	}
+	for _, data := range bad {
+		if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected to fail to read bad count check %s", data)
+		}
+	}
+}
+
+func TestCheckQueryCount(t *testing.T) {
+	one, three, five := 1, 3, 5
+	check := Check{
+		Description:     "Active workers",
+		Query:           "SELECT id FROM workers WHERE active",
+		Assert:          "count",
+		MinRows:         &three,
+		WarningMaxRows:  &five,
+		CriticalMinRows: &one,
+	}
+	cases := []struct {
+		rows     string
+		state    State
+		message  string
+		problems int
+	}{
+		{"1\n2\n3", StateOK, "", 0},
+		{"1\n2", StateOK, "Returned 2 rows, expected at least 3", 2},
+		{"", StateCritical, "Returned 0 rows, expected at least 1", 0},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12", StateWarning, "Returned 12 rows, expected at most 5", sampleRows},
+	}
+	for _, c := range cases {
+		// open database stub
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		mock.ExpectQuery(`SELECT.+`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).FromCSVString(c.rows))
+		result, err := CheckQueryCount(context.Background(), db, check)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s instead", err)
+		}
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expections: %s", err)
+		}
+		if result.State != c.state {
+			t.Errorf("Expected state %v for rows %q, got %v", c.state, c.rows, result.State)
+		}
+		if result.Message != c.message {
+			t.Errorf("Expected message %q for rows %q, got %q", c.message, c.rows, result.Message)
+		}
+		if len(result.Problems) != c.problems {
+			t.Errorf("Expected len of problems %v for rows %q, got %v", c.problems, c.rows, len(result.Problems))
+		}
+		db.Close()
+	}
+}
+
+func TestReadCheckEquals(t *testing.T) {
+	data := `
+description: Currency codes
+query: SELECT code, num, name FROM currencies
+assert: equals
+expected_columns: [code, num, name]
+expected:
+  - [USD, 840, US Dollar]
+  - [XXX, 999, null]
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	expectedRows := []Row{
+		TextRow("USD", "840", "US Dollar"),
+		{Cell{Value: "XXX"}, Cell{Value: "999"}, Cell{}},
+	}
+	if !eqRows(gotCheck.Expected, expectedRows) {
+		t.Errorf("Expected rows %v, got %v", expectedRows, gotCheck.Expected)
+	}
+
+	bad := []string{
+		`
+description: No expected rows
+query: SELECT 1
+assert: equals
+`,
+		`
+description: Rows of different width
+query: SELECT 1
+assert: equals
+expected: [[1, 2], [3]]
+`,
+		`
+description: Rows not matching columns
+query: SELECT 1
+assert: equals
+expected_columns: [id]
+expected: [[1, 2]]
+`,
+	}
+	for _, data := range bad {
+		if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected to fail to read bad equals check %s", data)
+		}
+	}
+}
+
+func TestCheckQueryEquals(t *testing.T) {
+	check := Check{
+		Description:     "Feature flags",
+		Query:           "SELECT name, enabled FROM flags",
+		Assert:          "equals",
+		Expected:        []Row{TextRow("search", "true"), TextRow("billing", "false")},
+		ExpectedColumns: []string{"name", "enabled"},
+	}
+	cases := []struct {
+		columns  []string
+		rows     string
+		expected CheckResult
+	}{
+		{
+			[]string{"name", "enabled"},
+			"billing,false\nsearch,true",
+			CheckResult{Check: check},
+		},
+		{
+			[]string{"name", "enabled"},
+			"search,true\nbilling,true",
+			CheckResult{
+				Check:   check,
+				Message: "Expected rows differ, 1 missing, 1 unexpected",
+				Columns: []string{"diff", "name", "enabled"},
+				Problems: []Row{
+					TextRow("missing", "billing", "false"),
+					TextRow("unexpected", "billing", "true"),
+				},
+			},
+		},
+		{
+			[]string{"flag", "enabled"},
+			"billing,false\nsearch,true",
+			CheckResult{
+				Check:   check,
+				Message: "Expected columns name, enabled, got flag, enabled",
+			},
+		},
+	}
+	for _, c := range cases {
+		// open database stub
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		mock.ExpectQuery(`SELECT.+`).
+			WillReturnRows(sqlmock.NewRows(c.columns).FromCSVString(c.rows))
+		result, err := CheckQueryEquals(context.Background(), db, check)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s instead", err)
+		}
+		if !eqResult(*result, c.expected) {
+			t.Errorf("Expected result %v, got %v", c.expected, *result)
+		}
+		db.Close()
+	}
+}
+
+func TestReadCheckExpression(t *testing.T) {
+	data := `
+description: Replication is lagging
+query: SELECT lag_seconds, state FROM replicas
+assert: all
+expression: lag_seconds < 30 && state == "streaming"
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	if gotCheck.Expression != `lag_seconds < 30 && state == "streaming"` {
+		t.Errorf("Unexpected check expression %v", gotCheck.Expression)
+	}
+
+	bad := []string{
+		`
+description: No expression
+query: SELECT 1
+assert: any
+`,
+		`
+description: Bad expression
+query: SELECT 1
+assert: none
+expression: lag_seconds < 
+`,
+		`
+description: Function call
+query: SELECT 1
+assert: all
+expression: os.Exit(1)
+`,
+	}
+	for _, data := range bad {
+		if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected to fail to read bad expression check %s", data)
+		}
+	}
+}
+
+func TestCheckQueryExpression(t *testing.T) {
+	columns := []string{"name", "lag_seconds"}
+	rows := "db1,10\ndb2,45"
+	cases := []struct {
+		assert   string
+		rows     string
+		expected CheckResult
+	}{
+		{
+			"all",
+			rows,
+			CheckResult{Columns: columns, Problems: []Row{TextRow("db2", "45")}},
+		},
+		{
+			"none",
+			rows,
+			CheckResult{Columns: columns, Problems: []Row{TextRow("db1", "10")}},
+		},
+		{
+			"any",
+			rows,
+			CheckResult{},
+		},
+		{
+			"any",
+			"db2,45",
+			CheckResult{Message: "None of 1 rows match lag_seconds < 30"},
+		},
+	}
+	for _, c := range cases {
+		check := Check{
+			Description: "Replication lag",
+			Query:       "SELECT name, lag_seconds FROM replicas",
+			Assert:      c.assert,
+			Expression:  "lag_seconds < 30",
+		}
+		// open database stub
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		mock.ExpectQuery(`SELECT.+`).
+			WillReturnRows(sqlmock.NewRows(columns).FromCSVString(c.rows))
+		result, err := CheckQueryExpression(context.Background(), db, check)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s instead", err)
+		}
+		c.expected.Check = check
+		if !eqResult(*result, c.expected) {
+			t.Errorf("Expected result %v, got %v", c.expected, *result)
+		}
+		db.Close()
+	}
+}
+
+func TestReadCheckReconcile(t *testing.T) {
+	data := `
+description: Orders match warehouse
+query: SELECT day, count(*) FROM orders GROUP BY day
+compare_query: SELECT day, orders FROM dwh.daily_orders
+compare_target: warehouse
+assert: reconcile
+key_columns: [day]
+tolerance: 0.5
+`
+	gotCheck, err := ReadCheck(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	expectedCheck := Check{
+		Description:   "Orders match warehouse",
+		Query:         "SELECT day, count(*) FROM orders GROUP BY day",
+		CompareQuery:  "SELECT day, orders FROM dwh.daily_orders",
+		CompareTarget: "warehouse",
+		Assert:        "reconcile",
+		KeyColumns:    []string{"day"},
+		Tolerance:     0.5,
+	}
+	if !eqCheck(*gotCheck, expectedCheck) {
+		t.Errorf("Got check %v not equal to expected %v", gotCheck, expectedCheck)
+	}
+
+	bad := []string{
+		`
+description: No compare target
+query: SELECT 1
+assert: reconcile
+`,
+		`
+description: Negative tolerance
+query: SELECT 1
+assert: reconcile
+compare_target: warehouse
+tolerance: -1
+`,
+	}
+	for _, data := range bad {
+		if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected to fail to read bad reconcile check %s", data)
+		}
+	}
+}
+
+func TestRunChecksTimeout(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	checks := []*Check{
+		{
+			Description: "some_table empty",
+			Query:       "SELECT id, some_col FROM some_table",
+			Assert:      "absent",
+			Timeout:     10 * time.Millisecond,
+		},
+		{
+			Description: "other_table non-empty",
+			Query:       "SELECT id, other_col FROM other_table",
+			Assert:      "present",
+		},
+	}
+	// match query it with regexp, each check runs in own transaction
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "some_col"}))
+	mock.ExpectQuery(`SELECT id, other_col FROM other_table`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "other_col"}).FromCSVString("1, OK"))
+	mock.ExpectRollback()
+	mock.ExpectRollback()
+
+	conns := []*connection{{db: db}}
+	result := runJobs(makeJobs(conns, checks), RunOptions{Concurrency: 2, Timeout: time.Minute})
+	if len(result) != len(checks) {
+		t.Fatalf("Expected %d results, got %d", len(checks), len(result))
+	}
+	for _, r := range result {
+		switch r.Check.Description {
+		case checks[0].Description:
+			if r.State != StateUnknown {
+				t.Errorf("Expected timed out check to be %v, got %v", StateUnknown, r.State)
+			}
+			if len(r.Problems) != 1 || !strings.HasPrefix(r.Problems[0][0].String(), "Check timed out after") {
+				t.Errorf("Expected timed out check to report timeout, got %v", r.Problems)
+			}
+		case checks[1].Description:
+			if r.HasProblems() {
+				t.Errorf("Expected finished check to have no problems, got %v", r.Problems)
+			}
+		}
+	}
+}
+
+func TestRunChecksTargets(t *testing.T) {
+	// open database stubs
+	db1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db1.Close()
+	db2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db2.Close()
+	mock1.MatchExpectationsInOrder(false)
+	mock2.MatchExpectationsInOrder(false)
+
+	checks := []*Check{
+		{
+			Description: "some_table empty",
+			Query:       "SELECT id, some_col FROM some_table",
+			Assert:      "absent",
+		},
+		{
+			Description: "replication lag",
+			Query:       "SELECT lag FROM replication",
+			Assert:      "absent",
+			TargetTags:  []string{"replica"},
+		},
+		{
+			Description: "no such target",
+			Query:       "SELECT 1",
+			Assert:      "present",
+			Targets:     []string{"warehouse"},
+		},
+	}
+	conns := []*connection{
+		{target: Target{Name: "primary"}, db: db1},
+		{target: Target{Name: "replica", Tags: []string{"replica"}}, db: db2},
+	}
+	for _, mock := range []sqlmock.Sqlmock{mock1, mock2} {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "some_col"}))
+		mock.ExpectRollback()
+	}
+	mock2.ExpectBegin()
+	mock2.ExpectQuery(`SELECT lag FROM replication`).
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).FromCSVString("100"))
+	mock2.ExpectRollback()
+
+	result := runJobs(makeJobs(conns, checks), RunOptions{Concurrency: 2, ProblemState: StateWarning})
+
+	expectedResult := []CheckResult{
+		{
+			Check:   *checks[0],
+			Columns: []string{"id", "some_col"},
+			Target:  "primary",
+		},
+		{
+			Check:   *checks[0],
+			Columns: []string{"id", "some_col"},
+			Target:  "replica",
+		},
+		{
+			Check:    *checks[1],
+			Columns:  []string{"lag"},
+			Problems: []Row{TextRow("100")},
+			State:    StateWarning,
+			Target:   "replica",
+		},
+		{
+			Check:    *checks[2],
+			Problems: []Row{TextRow("Check applies to no targets")},
+			State:    StateWarning,
+		},
+	}
+	for _, mock := range []sqlmock.Sqlmock{mock1, mock2} {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("there were unfulfilled expections: %s", err)
+		}
+	}
+	if len(result) != len(expectedResult) {
+		t.Fatalf("Expected %d results, got %d", len(expectedResult), len(result))
+	}
+	for _, r := range expectedResult {
+		if !ResultInSlice(r, result) {
+			t.Errorf("Expected to find %v in results %v", r, result)
+		}
+	}
+}
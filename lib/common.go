@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 // Error is our error log
@@ -13,13 +14,6 @@ var Error = log.New(os.Stderr,
 	"ERROR: ",
 	log.Ldate|log.Ltime|log.Lshortfile)
 
-// Row is a row of values from DB query
-type Row []string
-
-func (r Row) String() string {
-	return ToTabString(r)
-}
-
 // ToTabString returns keys and values in CSV format
 func ToTabString(values []string) string {
 	var list []string
@@ -31,28 +25,46 @@ func ToTabString(values []string) string {
 
 // CheckResult is a result of performed checks
 type CheckResult struct {
-	Check    Check `json:"check"`
-	Problems []Row `json:"problems"`
-	Columns  Row   `json:"columns"`
+	Check    Check         `json:"check"`
+	Problems []Row         `json:"problems"`
+	Columns  []string      `json:"columns"`
+	Message  string        `json:"message,omitempty"`
+	State    State         `json:"state"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Target   string        `json:"target,omitempty"`
 }
 
 // HasProblems indicates that CheckResult has problems
 func (c CheckResult) HasProblems() bool {
-	return len(c.Problems) > 0
+	return len(c.Problems) > 0 || c.Message != ""
+}
+
+// ProblemsCount returns number of problems in CheckResult,
+// result with only a message counts as a single problem
+func (c CheckResult) ProblemsCount() int {
+	if len(c.Problems) == 0 && c.Message != "" {
+		return 1
+	}
+	return len(c.Problems)
 }
 
 // FailedCheck provides easy way to create failed CheckResult
 func FailedCheck(c *Check, message string) *CheckResult {
 	return &CheckResult{
 		Check:    *c,
-		Problems: []Row{{message}},
+		Problems: []Row{TextRow(message)},
 	}
 }
 
 // String represents CheckResult as string
 func (c CheckResult) String() string {
 	result := fmt.Sprintf("Check: %v\n", c.Check)
-	result += fmt.Sprintf("Columns: %v\nProblems:\n", c.Columns.String())
+	result += fmt.Sprintf("Target: %v\n", c.Target)
+	result += fmt.Sprintf("State: %v\n", c.State)
+	if c.Message != "" {
+		result += fmt.Sprintf("Message: %v\n", c.Message)
+	}
+	result += fmt.Sprintf("Columns: %v\nProblems:\n", ToTabString(c.Columns))
 	for _, p := range c.Problems {
 		result += p.String() + "\n"
 	}
@@ -69,26 +81,13 @@ func ResultInSlice(needle CheckResult, list []CheckResult) bool {
 	return false
 }
 
-// FindCheckInCheckResults returns position of CheckResult with given Check in []CheckResult
-func FindCheckInCheckResults(needle Check, list []CheckResult) int {
+// FindCheckInCheckResults returns position of CheckResult with given Check and target in []CheckResult.
+// Checks are matched by ID, or by all fields for checks without ID from old reports.
+func FindCheckInCheckResults(needle Check, target string, list []CheckResult) int {
 	for pos, b := range list {
-		if needle == b.Check {
+		if sameCheck(needle, b.Check) && target == b.Target {
 			return pos
 		}
 	}
 	return -1
 }
-
-// NewRow is a row constructor
-func NewRow(fields []interface{}) Row {
-	var result Row
-	for _, t := range fields {
-		switch t := t.(type) {
-		default:
-			Error.Printf("unexpected type %T\n", t) // %T prints whatever type t has
-		case *[]byte:
-			result = append(result, string(*t))
-		}
-	}
-	return result
-}
@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DisabledColumn is a column of checks table which switches check off when true
+const DisabledColumn = "disabled"
+
+// DBSource is a table or query with checks in database, one check per row.
+// Columns are named as check fields, values of fields which are not strings,
+// like tags or vars, are given as YAML or JSON text.
+type DBSource struct {
+	// Target is a database with checks
+	Target Target
+	// Table with checks, like monitoring.checks
+	Table string
+	// Query selecting checks, overrides Table
+	Query string
+}
+
+// String returns description of DBSource used in messages
+func (s DBSource) String() string {
+	if s.Query != "" {
+		return fmt.Sprintf("query@%s", s.Target)
+	}
+	return fmt.Sprintf("%s@%s", s.Table, s.Target)
+}
+
+// query returns query selecting checks
+func (s DBSource) query() string {
+	if s.Query != "" {
+		return s.Query
+	}
+	return "SELECT * FROM " + s.Table
+}
+
+// Validate checks that DBSource has table or query and valid target
+func (s DBSource) Validate() error {
+	if s.Table == "" && s.Query == "" {
+		return errors.New("not a valid checks source, table or query is required")
+	}
+	return s.Target.Validate()
+}
+
+// checkFields are indexes of Check fields by their YAML names
+var checkFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(Check{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]; key != "" && key != "-" {
+			fields[key] = i
+		}
+	}
+	return fields
+}()
+
+// rowItem converts row of checks table to raw fields of check, NULL values are skipped.
+// Text of string fields is taken as is, and text of other fields is decoded as YAML.
+// Line of item is a row number.
+func rowItem(columns []string, row Row, n int) item {
+	it := item{fields: make(defaults), line: n}
+	for i, c := range columns {
+		if i >= len(row) || row[i].IsNull() {
+			continue
+		}
+		it.fields[c] = row[i].String()
+	}
+	it.decode = func(c *Check) error {
+		v := reflect.ValueOf(c).Elem()
+		for _, key := range columns {
+			text, ok := it.fields[key].(string)
+			i, isField := checkFields[key]
+			if !ok || !isField {
+				continue
+			}
+			field := v.Field(i)
+			if field.Kind() == reflect.String {
+				field.SetString(text)
+				continue
+			}
+			if err := yaml.Unmarshal([]byte(text), field.Addr().Interface()); err != nil {
+				return fmt.Errorf("not a valid check, bad '%s': %v", key, err)
+			}
+		}
+		return nil
+	}
+	return it
+}
+
+// isDisabled checks if raw fields of check from table have disabled flag set,
+// disabled flag is removed from fields
+func isDisabled(fields defaults) bool {
+	v, ok := fields[DisabledColumn]
+	if !ok {
+		return false
+	}
+	delete(fields, DisabledColumn)
+	disabled, err := strconv.ParseBool(fmt.Sprint(v))
+	return err == nil && disabled
+}
+
+// readDBItems reads raw fields of enabled checks from rows of query result
+func readDBItems(ctx context.Context, db Querier, query string) ([]item, error) {
+	columns, rows, err := queryAllRows(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range columns {
+		columns[i] = strings.ToLower(c)
+	}
+	var items []item
+	for i, row := range rows {
+		it := rowItem(columns, row, i+1)
+		if !isDisabled(it.fields) {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+// readDBSourceItems reads raw fields of enabled checks from source database in read-only transaction,
+// limited by timeout unless it is zero
+func readDBSourceItems(source DBSource, timeout time.Duration) ([]item, error) {
+	conns, err := openConnections([]Target{source.Target})
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnections(conns)
+	conn := conns[0]
+	if conn.err != nil {
+		return nil, conn.err
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tx, err := conn.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: conn.driver.ReadOnlyTx})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return readDBItems(ctx, tx, source.query())
+}
+
+// readDBItemCheck reads check from row item, checks from database must have IDs
+func readDBItemCheck(it item) (*Check, error) {
+	check, err := readItem(it, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if check.ID == "" {
+		return nil, errors.New("not a valid check, 'id' is required for checks from database")
+	}
+	return check, nil
+}
+
+// brokenDBCheck returns placeholder for row n of source which failed to load with err,
+// or for the whole source if n is zero
+func brokenDBCheck(source DBSource, id string, n int, err error) *Check {
+	c := &Check{
+		ID:          id,
+		Description: fmt.Sprintf("Failed to load checks from %s", source),
+		LoadError:   err.Error(),
+	}
+	if n > 0 {
+		c.Description = fmt.Sprintf("Failed to load check from %s, row %d", source, n)
+		c.LoadError = fmt.Sprintf("row %d: %v", n, err)
+	}
+	if c.ID == "" {
+		c.ID = source.String()
+		if n > 0 {
+			c.ID = fmt.Sprintf("%s#%d", source, n)
+		}
+	}
+	return c
+}
+
+// loadDBChecks reads enabled checks from source sorted by ID, passing rows
+// which fail to load to onError with ID of check if it is known
+func loadDBChecks(source DBSource, timeout time.Duration, onError func(id string, n int, err error)) ([]*Check, error) {
+	items, err := readDBSourceItems(source, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var checks []*Check
+	for _, it := range items {
+		check, err := readDBItemCheck(it)
+		if err != nil {
+			id, _ := it.fields["id"].(string)
+			onError(id, it.line, err)
+			continue
+		}
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].ID < checks[j].ID
+	})
+	return checks, nil
+}
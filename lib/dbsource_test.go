@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReadDBItems(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"ID", "description", "query", "assert", "tags", "timeout", "severity", "disabled"}
+	mock.ExpectQuery(`SELECT \* FROM monitoring.checks`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("unpaid", "Unpaid invoices", "SELECT id FROM invoices WHERE NOT paid", "absent", `["billing", "daily"]`, "10s", nil, false).
+			AddRow("failed", "Failed payments", "SELECT id FROM payments WHERE failed", "absent", nil, nil, "critical", true).
+			AddRow("refunds", "Refunds", "SELECT id FROM refunds", "present", "[billing", nil, nil, nil))
+
+	items, err := readDBItems(context.Background(), db, DBSource{Table: "monitoring.checks"}.query())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 enabled checks, got %d", len(items))
+	}
+
+	check, err := readDBItemCheck(items[0])
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	expected := Check{
+		ID:          "unpaid",
+		Description: "Unpaid invoices",
+		Query:       "SELECT id FROM invoices WHERE NOT paid",
+		Assert:      "absent",
+		Tags:        []string{"billing", "daily"},
+		Timeout:     10 * time.Second,
+	}
+	if !eqCheck(*check, expected) {
+		t.Errorf("Expected check %v, got %v", expected, *check)
+	}
+
+	if items[1].line != 3 {
+		t.Errorf("Expected item of row 3, got row %d", items[1].line)
+	}
+	if _, err := readDBItemCheck(items[1]); err == nil {
+		t.Error("Expected error for bad tags")
+	}
+
+	delete(items[0].fields, "id")
+	if _, err := readDBItemCheck(items[0]); err == nil {
+		t.Error("Expected error for check without ID")
+	}
+}
+
+func TestReadDBItemsKeepsText(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "description", "query", "assert", "expected", "vars"}
+	mock.ExpectQuery(`SELECT \* FROM monitoring.checks`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("settings", "Settings", "SELECT enabled, code, ratio FROM settings WHERE code = '${code}'", "equals",
+				"[[NO, 007, 1.50]]", "code: 007\nflag: on\n"))
+
+	items, err := readDBItems(context.Background(), db, DBSource{Table: "monitoring.checks"}.query())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	check, err := readDBItemCheck(items[0])
+	if err != nil {
+		t.Fatalf("Failed to read check: %v", err)
+	}
+	if got := check.Expected[0].Strings(); strings.Join(got, ",") != "NO,007,1.50" {
+		t.Errorf("Expected text of values to be kept, got %v", got)
+	}
+	if vars := check.Vars; vars["code"] != "007" || vars["flag"] != "on" {
+		t.Errorf("Expected text of vars to be kept, got %v", vars)
+	}
+}
+
+func TestReadDBSourceItemsTimeout(t *testing.T) {
+	// checks table is read through stub registered as driver of test DB type
+	db, mock, err := sqlmock.NewWithDSN("checks-timeout")
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	RegisterDriver("sqlmock", &Driver{
+		SQLDriver: "sqlmock",
+		DSN: func(t Target, password string) string {
+			return "checks-timeout"
+		},
+	})
+	defer delete(drivers, "sqlmock")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM monitoring.checks`).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("unpaid"))
+	mock.ExpectRollback()
+
+	source := DBSource{Target: Target{Type: "sqlmock"}, Table: "monitoring.checks"}
+	start := time.Now()
+	if _, err := readDBSourceItems(source, 50*time.Millisecond); err == nil {
+		t.Error("Expected error on timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected reading to stop on timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultsFiles are names of files with default values
+// for checks in the same directory and below
+var defaultsFiles = []string{"_defaults.yaml", "_defaults.yml"}
+
+// defaults are raw YAML fields of a check
+type defaults map[interface{}]interface{}
+
+// isDefaultsFile checks if file at path is a defaults file
+func isDefaultsFile(path string) bool {
+	name := filepath.Base(path)
+	for _, d := range defaultsFiles {
+		if name == d {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultsPath returns path of defaults file in dir which failed to load with err
+func defaultsPath(dir string, err error) string {
+	if fe, ok := err.(*fileError); ok && fe.path != "" {
+		return fe.path
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Path
+	}
+	return filepath.Join(dir, defaultsFiles[0])
+}
+
+// readDefaults reads defaults file in dir, returns nil if there is none
+func readDefaults(dir string) (*item, error) {
+	for _, name := range defaultsFiles {
+		path := filepath.Join(dir, name)
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items, err := readItems(b)
+		if err != nil {
+			return nil, inFile(err, path)
+		}
+		switch len(items) {
+		case 0:
+			return nil, nil
+		case 1:
+		default:
+			return nil, &fileError{path: path, line: items[1].line, err: errors.New("expected single mapping of default values")}
+		}
+		it := items[0]
+		for _, key := range []string{"id", "description", "query", "query_file"} {
+			// IDs must be unique, so they can't be shared by checks either
+			if _, ok := it.fields[key]; ok {
+				return nil, &fileError{path: path, line: it.keys[key], err: fmt.Errorf("'%s' can't have default value", key)}
+			}
+		}
+		// check that defaults are valid check fields
+		var c Check
+		if err := it.decodeInto(&c); err != nil {
+			return nil, inFile(err, path)
+		}
+		return &it, nil
+	}
+	return nil, nil
+}
+
+// defaultsChain are defaults of directory and its parents, starting from the top one
+type defaultsChain []item
+
+// decodeInto decodes fields of item into check c, overriding fields of c
+// which are set in item, except vars, which are overridden one by one
+func (it item) decodeInto(c *Check) error {
+	vars := c.Vars
+	c.Vars = nil
+	if err := it.decode(c); err != nil {
+		return err
+	}
+	if len(vars) > 0 {
+		merged := make(map[string]string, len(vars)+len(c.Vars))
+		for name, value := range vars {
+			merged[name] = value
+		}
+		for name, value := range c.Vars {
+			merged[name] = value
+		}
+		c.Vars = merged
+	}
+	return nil
+}
+
+// asMap returns v as YAML mapping
+func asMap(v interface{}) (defaults, bool) {
+	switch m := v.(type) {
+	case defaults:
+		return m, true
+	case map[interface{}]interface{}:
+		return defaults(m), true
+	}
+	return nil, false
+}
@@ -8,11 +8,16 @@ import (
 
 // DiffRows calculates diff (in form of slice of Row) between two slices of Row
 func DiffRows(first, second []Row) []Row {
+	return diffRows(first, second, Row.key)
+}
+
+// diffRows calculates diff between two slices of Row compared by key
+func diffRows(first, second []Row, key func(Row) string) []Row {
 	var add []Row
 	m := make(map[string]int)
 
 	for _, y := range first {
-		s := y.String()
+		s := key(y)
 		if _, ok := m[s]; ok {
 			m[s]++
 		} else {
@@ -21,8 +26,8 @@ func DiffRows(first, second []Row) []Row {
 	}
 
 	for _, x := range second {
-		if m[x.String()] > 0 {
-			m[x.String()]--
+		if m[key(x)] > 0 {
+			m[key(x)]--
 			continue
 		}
 		add = append(add, x)
@@ -35,17 +40,25 @@ func DiffResults(first, second []CheckResult) []CheckResult {
 	var add []CheckResult
 
 	for _, s := range second {
-		pos := FindCheckInCheckResults(s.Check, first)
+		pos := FindCheckInCheckResults(s.Check, s.Target, first)
 		if pos == -1 {
 			add = append(add, s)
 		} else {
 			old := first[pos]
 			diff := DiffRows(old.Problems, s.Problems)
-			if len(diff) > 0 {
+			if old.Check.ID == "" {
+				// old reports created before check IDs could have NULL stored as empty string
+				diff = diffRows(old.Problems, s.Problems, Row.legacyKey)
+			}
+			if len(diff) > 0 || (s.Message != "" && s.Message != old.Message) {
 				add = append(add, CheckResult{
 					Check:    s.Check,
 					Columns:  s.Columns,
+					Message:  s.Message,
 					Problems: diff,
+					State:    s.State,
+					Duration: s.Duration,
+					Target:   s.Target,
 				})
 			}
 		}
@@ -1,23 +1,26 @@
 package lib
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestDiffRows(t *testing.T) {
 	first := []Row{
-		Row{"181620", "4", "15"},
-		Row{"181620", "4", "15"},
-		Row{"236695", "2", "3"},
-		Row{"381630", "43", "153"},
+		TextRow("181620", "4", "15"),
+		TextRow("181620", "4", "15"),
+		TextRow("236695", "2", "3"),
+		TextRow("381630", "43", "153"),
 	}
 	second := []Row{
-		Row{"181620", "4", "15"},
-		Row{"181620", "4", "15"},
-		Row{"236695", "2", "3"},
-		Row{"581650", "53", "1"},
+		TextRow("181620", "4", "15"),
+		TextRow("181620", "4", "15"),
+		TextRow("236695", "2", "3"),
+		TextRow("581650", "53", "1"),
 	}
 
 	expectedAdd := []Row{
-		Row{"581650", "53", "1"},
+		TextRow("581650", "53", "1"),
 	}
 
 	add := DiffRows(first, second)
@@ -35,8 +38,8 @@ func TestDiffResults(t *testing.T) {
 				Query:       "SELECT * from tbl",
 			},
 			Problems: []Row{
-				{"181620", "4", "15"},
-				{"236695", "2", "3"},
+				TextRow("181620", "4", "15"),
+				TextRow("236695", "2", "3"),
 			},
 		},
 		{
@@ -45,7 +48,7 @@ func TestDiffResults(t *testing.T) {
 				Query:       "SELECT * from tbl LIMIT 1",
 			},
 			Problems: []Row{
-				{"181620", "-200", t1},
+				TextRow("181620", "-200", t1),
 			},
 		},
 	}
@@ -56,8 +59,8 @@ func TestDiffResults(t *testing.T) {
 				Query:       "SELECT * from tbl",
 			},
 			Problems: []Row{
-				{"181620", "4", "15"},
-				{"998899", "20", "30"},
+				TextRow("181620", "4", "15"),
+				TextRow("998899", "20", "30"),
 			},
 		},
 		{
@@ -66,7 +69,7 @@ func TestDiffResults(t *testing.T) {
 				Query:       "SELECT * from tbl LIMIT 1",
 			},
 			Problems: []Row{
-				{"181620", "-200", t1},
+				TextRow("181620", "-200", t1),
 			},
 		},
 	}
@@ -77,7 +80,7 @@ func TestDiffResults(t *testing.T) {
 				Query:       "SELECT * from tbl",
 			},
 			Problems: []Row{
-				{"998899", "20", "30"},
+				TextRow("998899", "20", "30"),
 			},
 		},
 	}
@@ -94,3 +97,101 @@ func TestDiffResults(t *testing.T) {
 		}
 	}
 }
+
+func TestDiffResultsTargets(t *testing.T) {
+	check := Check{
+		Description: "Other check",
+		Query:       "SELECT * from tbl LIMIT 1",
+	}
+	first := []CheckResult{
+		{
+			Check:    check,
+			Target:   "primary",
+			Problems: []Row{TextRow("181620", "-200")},
+		},
+	}
+	second := []CheckResult{
+		{
+			Check:    check,
+			Target:   "primary",
+			Problems: []Row{TextRow("181620", "-200")},
+		},
+		{
+			Check:    check,
+			Target:   "replica",
+			Problems: []Row{TextRow("181620", "-200")},
+		},
+	}
+	add := DiffResults(first, second)
+	if len(add) != 1 {
+		t.Fatalf("Got add len %v not equal to expected 1", len(add))
+	}
+	if add[0].Target != "replica" {
+		t.Errorf("Expected new problems from replica target, got %v", add[0].Target)
+	}
+}
+
+func TestDiffResultsIDs(t *testing.T) {
+	problems := []Row{TextRow("181620", "-200")}
+	// old report created before check IDs
+	first := []CheckResult{
+		{
+			Check:    Check{Description: "Negative balance", Query: "SELECT * from balances"},
+			Problems: problems,
+		},
+	}
+	second := []CheckResult{
+		{
+			Check:    Check{ID: "balances", Description: "Negative balance", Query: "SELECT * from balances"},
+			Problems: problems,
+		},
+	}
+	if add := DiffResults(first, second); len(add) != 0 {
+		t.Errorf("Expected check from old report to match check with ID, got diff %v", add)
+	}
+
+	// check was edited but kept its ID
+	first = second
+	second = []CheckResult{
+		{
+			Check:    Check{ID: "balances", Description: "Negative balances", Query: "SELECT * FROM balances"},
+			Problems: problems,
+		},
+		{
+			Check:    Check{ID: "other", Description: "Negative balances", Query: "SELECT * FROM balances"},
+			Problems: problems,
+		},
+	}
+	add := DiffResults(first, second)
+	if len(add) != 1 || add[0].Check.ID != "other" {
+		t.Errorf("Expected only check with new ID in diff, got %v", add)
+	}
+}
+
+func TestDiffResultsOldNulls(t *testing.T) {
+	// old report created before check IDs and typed cells stored NULL as empty string
+	var first []CheckResult
+	data := `[{"check":{"Description":"Users without email","Query":"SELECT id, email FROM users"},"problems":[["1",""]],"columns":["id","email"],"state":"WARNING"}]`
+	if err := json.Unmarshal([]byte(data), &first); err != nil {
+		t.Fatal(err)
+	}
+	second := []CheckResult{
+		{
+			Check:    Check{ID: "users", Description: "Users without email", Query: "SELECT id, email FROM users"},
+			Columns:  []string{"id", "email"},
+			Problems: []Row{{Cell{Value: int64(1)}, Cell{}}, {Cell{Value: int64(2)}, Cell{}}},
+			State:    StateWarning,
+		},
+	}
+	add := DiffResults(first, second)
+	if len(add) != 1 || len(add[0].Problems) != 1 || add[0].Problems[0][0].String() != "2" {
+		t.Errorf("Expected only row 2 to be new, got %v", add)
+	}
+
+	// reports with IDs keep NULL distinct from empty string
+	first[0].Check.ID = "users"
+	add = DiffResults(first, second)
+	if len(add) != 1 || len(add[0].Problems) != 2 {
+		t.Errorf("Expected both rows to be new, got %v", add)
+	}
+}
@@ -1,7 +1,37 @@
 package lib
 
+import "reflect"
+
+// eqCheck checks if two Checks are equal
+func eqCheck(first, second Check) bool {
+	return reflect.DeepEqual(first, second)
+}
+
+// sameCheck checks if two Checks are the same check, possibly edited.
+// Checks with IDs are compared by ID, otherwise all their other fields must be equal.
+func sameCheck(first, second Check) bool {
+	if first.ID != "" && second.ID != "" {
+		return first.ID == second.ID
+	}
+	first.ID, second.ID = "", ""
+	return eqCheck(first, second)
+}
+
 // eqRow check if two Rows are equal, order of elements matters
 func eqRow(first, second Row) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i, f := range first {
+		if !eqCell(second[i], f) {
+			return false
+		}
+	}
+	return true
+}
+
+// eqStrings check if two []string are equal, order of elements matters
+func eqStrings(first, second []string) bool {
 	if len(first) != len(second) {
 		return false
 	}
@@ -28,10 +58,19 @@ func eqRows(first, second []Row) bool {
 
 // eqResult checks if tow CheckResults are equal
 func eqResult(a, b CheckResult) bool {
-	if a.Check != b.Check {
+	if !eqCheck(a.Check, b.Check) {
+		return false
+	}
+	if a.Target != b.Target {
+		return false
+	}
+	if a.State != b.State {
+		return false
+	}
+	if a.Message != b.Message {
 		return false
 	}
-	if !eqRow(a.Columns, b.Columns) {
+	if !eqStrings(a.Columns, b.Columns) {
 		return false
 	}
 	if !eqRows(a.Problems, b.Problems) {
@@ -9,8 +9,8 @@ func TestEqResults(t *testing.T) {
 			Query:       "SELECT * FROM tbl;",
 		},
 		Problems: []Row{
-			Row{"181620", "4", "15"},
-			Row{"236695", "2", "3"},
+			TextRow("181620", "4", "15"),
+			TextRow("236695", "2", "3"),
 		},
 	}
 	result2 := CheckResult{
@@ -19,7 +19,7 @@ func TestEqResults(t *testing.T) {
 			Query:       "SELECT * FROM tbl;",
 		},
 		Problems: []Row{
-			Row{"181620", "-200", "t1"},
+			TextRow("181620", "-200", "t1"),
 		},
 	}
 	result3 := CheckResult{
@@ -28,8 +28,8 @@ func TestEqResults(t *testing.T) {
 			Query:       "SELECT * FROM tbl;",
 		},
 		Problems: []Row{
-			Row{"181620", "4", "15"},
-			Row{"236695", "2", "3"},
+			TextRow("181620", "4", "15"),
+			TextRow("236695", "2", "3"),
 		},
 	}
 
@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+)
+
+// expression is a compiled boolean expression over row columns,
+// it uses Go syntax but allows only literals, column names and operators
+type expression struct {
+	source string
+	node   ast.Expr
+}
+
+// constants are identifiers which are not column names
+var constants = map[string]interface{}{
+	"true":  true,
+	"false": false,
+	"null":  nil,
+	"nil":   nil,
+}
+
+// compileExpression parses expression and checks that it uses only allowed syntax
+func compileExpression(source string) (*expression, error) {
+	node, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("bad expression %q: %v", source, err)
+	}
+	var bad ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if bad != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case nil, *ast.Ident, *ast.ParenExpr:
+		case *ast.BasicLit:
+			if n.Kind == token.CHAR || n.Kind == token.IMAG {
+				bad = n
+			}
+		case *ast.UnaryExpr:
+			if n.Op != token.NOT && n.Op != token.SUB {
+				bad = n
+			}
+		case *ast.BinaryExpr:
+			switch n.Op {
+			case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+				token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+			default:
+				bad = n
+			}
+		default:
+			bad = n
+		}
+		return bad == nil
+	})
+	if bad != nil {
+		return nil, fmt.Errorf("bad expression %q: unsupported syntax at position %d", source, bad.Pos())
+	}
+	return &expression{source: source, node: node}, nil
+}
+
+// match evaluates expression against row with given columns
+func (e *expression) match(columns []string, row Row) (bool, error) {
+	vars := make(map[string]interface{}, len(columns))
+	for i, c := range columns {
+		if i < len(row) {
+			vars[c] = cellValue(row[i])
+		}
+	}
+	v, err := eval(e.node, vars)
+	if err != nil {
+		return false, fmt.Errorf("expression %q: %v", e.source, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q: result %v is not boolean", e.source, v)
+	}
+	return b, nil
+}
+
+// cellValue converts Cell to one of expression value types: nil, bool, float64 or string
+func cellValue(c Cell) interface{} {
+	switch v := c.Value.(type) {
+	case nil, bool, float64, string:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	default:
+		return c.String()
+	}
+}
+
+// toNumber converts expression value to number, strings are parsed
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func eval(node ast.Expr, vars map[string]interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return eval(n.X, vars)
+	case *ast.Ident:
+		if v, ok := constants[n.Name]; ok {
+			return v, nil
+		}
+		v, ok := vars[n.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s", n.Name)
+		}
+		return v, nil
+	case *ast.BasicLit:
+		if n.Kind == token.STRING {
+			return strconv.Unquote(n.Value)
+		}
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.UnaryExpr:
+		x, err := eval(n.X, vars)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == token.NOT {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operand of ! is not boolean: %v", x)
+			}
+			return !b, nil
+		}
+		f, ok := toNumber(x)
+		if !ok {
+			return nil, fmt.Errorf("operand of - is not a number: %v", x)
+		}
+		return -f, nil
+	case *ast.BinaryExpr:
+		return evalBinary(n, vars)
+	}
+	return nil, errors.New("unsupported syntax")
+}
+
+func evalBinary(n *ast.BinaryExpr, vars map[string]interface{}) (interface{}, error) {
+	x, err := eval(n.X, vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == token.LAND || n.Op == token.LOR {
+		bx, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of %s is not boolean: %v", n.Op, x)
+		}
+		// short-circuit evaluation
+		if (n.Op == token.LAND && !bx) || (n.Op == token.LOR && bx) {
+			return bx, nil
+		}
+		y, err := eval(n.Y, vars)
+		if err != nil {
+			return nil, err
+		}
+		by, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of %s is not boolean: %v", n.Op, y)
+		}
+		return by, nil
+	}
+	y, err := eval(n.Y, vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case token.EQL:
+		return equal(x, y), nil
+	case token.NEQ:
+		return !equal(x, y), nil
+	}
+	if x == nil || y == nil {
+		// like in SQL, NULL is not comparable and poisons arithmetic
+		switch n.Op {
+		case token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return false, nil
+		}
+		return nil, nil
+	}
+	sx, xIsString := x.(string)
+	sy, yIsString := y.(string)
+	if xIsString && yIsString {
+		switch n.Op {
+		case token.LSS:
+			return sx < sy, nil
+		case token.LEQ:
+			return sx <= sy, nil
+		case token.GTR:
+			return sx > sy, nil
+		case token.GEQ:
+			return sx >= sy, nil
+		case token.ADD:
+			return sx + sy, nil
+		}
+	}
+	fx, okx := toNumber(x)
+	fy, oky := toNumber(y)
+	if !okx || !oky {
+		return nil, fmt.Errorf("operands of %s are not numbers: %v, %v", n.Op, x, y)
+	}
+	switch n.Op {
+	case token.LSS:
+		return fx < fy, nil
+	case token.LEQ:
+		return fx <= fy, nil
+	case token.GTR:
+		return fx > fy, nil
+	case token.GEQ:
+		return fx >= fy, nil
+	case token.ADD:
+		return fx + fy, nil
+	case token.SUB:
+		return fx - fy, nil
+	case token.MUL:
+		return fx * fy, nil
+	case token.QUO:
+		return fx / fy, nil
+	case token.REM:
+		return math.Mod(fx, fy), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.Op)
+}
+
+// equal compares expression values,
+// strings are compared with numbers and booleans after conversion
+func equal(x, y interface{}) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	sx, xIsString := x.(string)
+	sy, yIsString := y.(string)
+	if xIsString && yIsString {
+		return sx == sy
+	}
+	if xIsString {
+		x, y = y, x
+		sy = sx
+		yIsString = true
+	}
+	if b, ok := x.(bool); ok && yIsString {
+		by, err := strconv.ParseBool(sy)
+		return err == nil && b == by
+	}
+	if fx, ok := toNumber(x); ok {
+		if fy, ok := toNumber(y); ok {
+			return fx == fy
+		}
+	}
+	return x == y
+}
@@ -0,0 +1,63 @@
+package lib
+
+import "testing"
+
+func TestCompileExpressionBad(t *testing.T) {
+	bad := []string{
+		"",
+		"lag <",
+		"os.Exit(1)",
+		"len(state) > 0",
+		"rows[0] == 1",
+		"lag << 2",
+		"'s' == state",
+		"func() bool { return true }()",
+	}
+	for _, source := range bad {
+		if _, err := compileExpression(source); err == nil {
+			t.Errorf("Expected to fail to compile expression %q", source)
+		}
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	columns := []string{"lag_seconds", "state", "sync", "comment"}
+	row := Row{Cell{Value: int64(12)}, Cell{Value: "streaming"}, Cell{Value: "true"}, Cell{}}
+	cases := []struct {
+		source   string
+		expected bool
+	}{
+		{`lag_seconds < 30 && state == "streaming"`, true},
+		{`lag_seconds * 2 >= 30 || state != "streaming"`, false},
+		{`!(lag_seconds % 5 == 2)`, false},
+		{`-lag_seconds < 0`, true},
+		{`lag_seconds == "12"`, true},
+		{`sync == true`, true},
+		{`comment == null`, true},
+		{`comment > 0`, false},
+		{`state + "!" == "streaming!"`, true},
+	}
+	for _, c := range cases {
+		expr, err := compileExpression(c.source)
+		if err != nil {
+			t.Fatalf("Failed to compile expression %q: %v", c.source, err)
+		}
+		got, err := expr.match(columns, row)
+		if err != nil {
+			t.Fatalf("Failed to evaluate expression %q: %v", c.source, err)
+		}
+		if got != c.expected {
+			t.Errorf("Expected %q to be %v, got %v", c.source, c.expected, got)
+		}
+	}
+
+	for _, source := range []string{"lag_seconds", "unknown > 1", `state > 1`, `!state`} {
+		expr, err := compileExpression(source)
+		if err != nil {
+			t.Fatalf("Failed to compile expression %q: %v", source, err)
+		}
+		if _, err := expr.match(columns, row); err == nil {
+			t.Errorf("Expected to fail to evaluate expression %q", source)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats are names of supported output formats of check results
+var Formats = []string{"json", "junit", "tap", "markdown"}
+
+// formatters write check results in some format
+var formatters = map[string]func(w io.Writer, results []CheckResult) error{
+	"json":     writeJSON,
+	"junit":    writeJUnit,
+	"tap":      writeTAP,
+	"markdown": writeMarkdown,
+}
+
+// ValidateFormat checks if format is supported
+func ValidateFormat(format string) error {
+	if _, ok := formatters[format]; !ok {
+		return fmt.Errorf("unknown format %q, use one of: %s", format, strings.Join(Formats, ", "))
+	}
+	return nil
+}
+
+// WriteFormat writes check results to w in format, sorted by check ID and target
+func WriteFormat(w io.Writer, format string, results []CheckResult) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+	sorted := make([]CheckResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Check.ID != sorted[j].Check.ID {
+			return sorted[i].Check.ID < sorted[j].Check.ID
+		}
+		if sorted[i].Check.Description != sorted[j].Check.Description {
+			return sorted[i].Check.Description < sorted[j].Check.Description
+		}
+		return sorted[i].Target < sorted[j].Target
+	})
+	return formatters[format](w, sorted)
+}
+
+// name returns name of CheckResult used in formatted output
+func (c CheckResult) name() string {
+	if c.Target != "" {
+		return fmt.Sprintf("%s: %s", c.Target, c.Check.Description)
+	}
+	return c.Check.Description
+}
+
+// problemsText returns message and problems of CheckResult as text table
+func (c CheckResult) problemsText() string {
+	var buffer bytes.Buffer
+	w := tabwriter.NewWriter(&buffer, 1, 1, 0, ' ', 0)
+	if c.Message != "" {
+		fmt.Fprintf(w, "%s\n", c.Message)
+	}
+	if len(c.Columns) != 0 {
+		fmt.Fprintf(w, "%s\n", ToTabString(c.Columns))
+	}
+	for _, p := range c.Problems {
+		fmt.Fprintf(w, "%s\n", p)
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// formattedResult is CheckResult in JSON and TAP output
+type formattedResult struct {
+	ID          string   `json:"id,omitempty" yaml:"id,omitempty"`
+	Description string   `json:"description" yaml:"description"`
+	Target      string   `json:"target,omitempty" yaml:"target,omitempty"`
+	State       string   `json:"state" yaml:"state"`
+	Duration    float64  `json:"duration" yaml:"duration"`
+	Message     string   `json:"message,omitempty" yaml:"message,omitempty"`
+	Columns     []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Problems    []Row    `json:"problems,omitempty" yaml:"problems,omitempty"`
+}
+
+// formatted converts CheckResult for output, duration is in seconds,
+// and NULL values of problems are null, unlike 'NULL' text
+func (c CheckResult) formatted() formattedResult {
+	return formattedResult{
+		ID:          c.Check.ID,
+		Description: c.Check.Description,
+		Target:      c.Target,
+		State:       c.State.String(),
+		Duration:    c.Duration.Seconds(),
+		Message:     c.Message,
+		Columns:     c.Columns,
+		Problems:    c.Problems,
+	}
+}
+
+// writeJSON writes check results as JSON list
+func writeJSON(w io.Writer, results []CheckResult) error {
+	list := make([]formattedResult, 0, len(results))
+	for _, cr := range results {
+		list = append(list, cr.formatted())
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// junitFailure is a failure or an error of JUnit test case
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// writeJUnit writes check results as JUnit XML test suite, where checks with
+// WARNING or CRITICAL state are failures, and checks with UNKNOWN state are errors
+func writeJUnit(w io.Writer, results []CheckResult) error {
+	suite := junitTestSuite{Name: "db-checker", Tests: len(results)}
+	total := 0.0
+	for _, cr := range results {
+		total += cr.Duration.Seconds()
+		tc := junitTestCase{
+			Name:      cr.name(),
+			ClassName: cr.Check.ID,
+			Time:      fmt.Sprintf("%.3f", cr.Duration.Seconds()),
+		}
+		if tc.ClassName == "" {
+			tc.ClassName = "db-checker"
+		}
+		if cr.State != StateOK {
+			failure := &junitFailure{
+				Message: fmt.Sprintf("%d problems found", cr.ProblemsCount()),
+				Type:    cr.State.String(),
+				Text:    cr.problemsText(),
+			}
+			if cr.State == StateUnknown {
+				tc.Error = failure
+				suite.Errors++
+			} else {
+				tc.Failure = failure
+				suite.Failures++
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// writeTAP writes check results in Test Anything Protocol version 13,
+// details of every check are given in YAML block
+func writeTAP(w io.Writer, results []CheckResult) error {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results))
+	for i, cr := range results {
+		status := "ok"
+		if cr.State != StateOK {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s\n", status, i+1, strings.Replace(cr.name(), "#", `\#`, -1))
+		data, err := yaml.Marshal(cr.formatted())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "  ---")
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		if _, err := fmt.Fprintln(w, "  ..."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCell escapes text for Markdown table cell
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(strings.TrimSpace(s), "\n", "<br>", -1)
+}
+
+// markdownRow formats values as Markdown table row
+func markdownRow(values []string) string {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = markdownCell(v)
+	}
+	return "| " + strings.Join(cells, " | ") + " |\n"
+}
+
+// writeMarkdown writes summary table of check results,
+// followed by tables of problems of every check with problems
+func writeMarkdown(w io.Writer, results []CheckResult) error {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# db-checker results: %s\n\n", WorstState(results))
+	buffer.WriteString(markdownRow([]string{"State", "Check", "Target", "Duration", "Problems"}))
+	buffer.WriteString("| --- | --- | --- | ---: | ---: |\n")
+	for _, cr := range results {
+		buffer.WriteString(markdownRow([]string{
+			cr.State.String(),
+			cr.Check.Description,
+			cr.Target,
+			cr.Duration.String(),
+			fmt.Sprint(cr.ProblemsCount()),
+		}))
+	}
+	for _, cr := range results {
+		if !cr.HasProblems() {
+			continue
+		}
+		fmt.Fprintf(&buffer, "\n## [%s] %s\n\n", cr.State, markdownCell(cr.name()))
+		if cr.Message != "" {
+			fmt.Fprintf(&buffer, "%s\n\n", cr.Message)
+		}
+		if len(cr.Columns) == 0 {
+			for _, p := range cr.Problems {
+				fmt.Fprintf(&buffer, "* %s\n", markdownCell(strings.Join(p.Strings(), ", ")))
+			}
+			continue
+		}
+		buffer.WriteString(markdownRow(cr.Columns))
+		buffer.WriteString(strings.Repeat("| --- ", len(cr.Columns)) + "|\n")
+		for _, p := range cr.Problems {
+			buffer.WriteString(markdownRow(p.Strings()))
+		}
+	}
+	_, err := buffer.WriteTo(w)
+	return err
+}
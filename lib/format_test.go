@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formatResults = []CheckResult{
+	{
+		Check:    Check{ID: "users", Description: "Users with negative balance"},
+		Columns:  []string{"user_id", "balance"},
+		Problems: []Row{TextRow("181620", "-200"), TextRow("236695", "a|b"), {Cell{Value: "NULL"}, Cell{}}},
+		State:    StateCritical,
+		Duration: 1500 * time.Millisecond,
+		Target:   "main",
+	},
+	{
+		Check:    Check{ID: "broken", Description: "Broken check"},
+		Message:  "syntax error",
+		State:    StateUnknown,
+		Duration: 10 * time.Millisecond,
+	},
+	{
+		Check:    Check{ID: "orders", Description: "Stale orders"},
+		Columns:  []string{"id"},
+		State:    StateOK,
+		Duration: 250 * time.Millisecond,
+	},
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range Formats {
+		if err := ValidateFormat(format); err != nil {
+			t.Errorf("Expected format %s to be valid, got %v", format, err)
+		}
+	}
+	if err := ValidateFormat("csv"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestWriteFormatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFormat(&buf, "json", formatResults); err != nil {
+		t.Fatal(err)
+	}
+	var got []formattedResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range got {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, ",") != "broken,orders,users" {
+		t.Errorf("Expected results sorted by ID, got %v", ids)
+	}
+	users := got[2]
+	if users.State != "CRITICAL" || users.Duration != 1.5 || users.Target != "main" {
+		t.Errorf("Unexpected result %+v", users)
+	}
+	if len(users.Problems) != 3 || users.Problems[1][1].String() != "a|b" {
+		t.Errorf("Unexpected problems %v", users.Problems)
+	}
+	if null := users.Problems[2]; null[0].IsNull() || !null[1].IsNull() {
+		t.Errorf("Expected only SQL NULL to be null, got %v", null)
+	}
+}
+
+func TestWriteFormatJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFormat(&buf, "junit", formatResults); err != nil {
+		t.Fatal(err)
+	}
+	var suite junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 || suite.Time != "1.760" {
+		t.Errorf("Unexpected suite %+v", suite)
+	}
+	if suite.Cases[0].Error == nil || suite.Cases[0].Error.Text != "syntax error\n" {
+		t.Errorf("Expected error for UNKNOWN check, got %+v", suite.Cases[0])
+	}
+	if suite.Cases[1].Failure != nil || suite.Cases[1].Error != nil {
+		t.Errorf("Expected OK check to pass, got %+v", suite.Cases[1])
+	}
+	users := suite.Cases[2]
+	if users.Name != "main: Users with negative balance" || users.Failure == nil || users.Failure.Type != "CRITICAL" {
+		t.Errorf("Expected failure for CRITICAL check, got %+v", users)
+	}
+	if !strings.Contains(users.Failure.Text, "181620  ¦ -200") {
+		t.Errorf("Expected problems in failure text, got %q", users.Failure.Text)
+	}
+}
+
+func TestWriteFormatTAP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFormat(&buf, "tap", formatResults); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"TAP version 13\n1..3\n",
+		"not ok 1 - Broken check\n",
+		"ok 2 - Stale orders\n",
+		"not ok 3 - main: Users with negative balance\n",
+		"  state: CRITICAL\n",
+		"  duration: 1.5\n",
+		"  - - \"181620\"\n",
+		"  - - \"NULL\"\n    - null\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestWriteFormatMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFormat(&buf, "markdown", formatResults); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# db-checker results: UNKNOWN\n",
+		"| CRITICAL | Users with negative balance | main | 1.5s | 3 |\n",
+		"| OK | Stale orders |  | 250ms | 0 |\n",
+		"## [CRITICAL] main: Users with negative balance\n",
+		"| user_id | balance |\n| --- | --- |\n| 181620 | -200 |\n| 236695 | a\\|b |\n",
+		"## [UNKNOWN] Broken check\n\nsyntax error\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in output:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "## [OK]") {
+		t.Errorf("Expected no section for check without problems:\n%s", out)
+	}
+}
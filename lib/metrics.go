@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// metric is a description of Prometheus gauge exposed for each check
+type metric struct {
+	name  string
+	help  string
+	value func(sr scheduledResult) float64
+}
+
+var metrics = []metric{
+	{
+		name: "db_checker_check_problems",
+		help: "Number of problems found by check.",
+		value: func(sr scheduledResult) float64 {
+			return float64(sr.result.ProblemsCount())
+		},
+	},
+	{
+		name: "db_checker_check_success",
+		help: "Whether check passed (1) or failed (0).",
+		value: func(sr scheduledResult) float64 {
+			if sr.result.State == StateOK {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name: "db_checker_check_state",
+		help: "Nagios state of check: 0 - OK, 1 - WARNING, 2 - CRITICAL, 3 - UNKNOWN.",
+		value: func(sr scheduledResult) float64 {
+			return float64(sr.result.State)
+		},
+	},
+	{
+		name: "db_checker_check_duration_seconds",
+		help: "Duration of check query in seconds.",
+		value: func(sr scheduledResult) float64 {
+			return sr.result.Duration.Seconds()
+		},
+	},
+	{
+		name: "db_checker_check_last_run_timestamp_seconds",
+		help: "Unix time of the last check run.",
+		value: func(sr scheduledResult) float64 {
+			return float64(sr.lastRun.UnixNano()) / 1e9
+		},
+	},
+}
+
+// labelValueReplacer escapes label values in Prometheus text format
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes latest results of checks in Prometheus text format,
+// labeled by check ID, description and database, which is result target
+// or given database for results without target
+func (s *Scheduler) WriteMetrics(w io.Writer, database string) error {
+	return writeMetrics(w, s.scheduledResults(), database)
+}
+
+func writeMetrics(w io.Writer, results []scheduledResult, database string) error {
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for _, sr := range results {
+			db := database
+			if sr.result.Target != "" {
+				db = sr.result.Target
+			}
+			_, err := fmt.Fprintf(w, "%s{id=\"%s\",check=\"%s\",database=\"%s\"} %s\n",
+				m.name,
+				labelValueReplacer.Replace(sr.result.Check.ID),
+				labelValueReplacer.Replace(sr.result.Check.Description),
+				labelValueReplacer.Replace(db),
+				strconv.FormatFloat(m.value(sr), 'f', -1, 64),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	results := []scheduledResult{
+		{
+			result: CheckResult{
+				Check: Check{
+					ID:          "mismatch",
+					Description: `Mismatch between "tbl_one" and tbl_two`,
+					Query:       "SELECT * FROM tbl;",
+				},
+				Problems: []Row{
+					TextRow("181620", "4", "15"),
+					TextRow("236695", "2", "30"),
+				},
+				State:    StateWarning,
+				Duration: 1500 * time.Millisecond,
+			},
+			lastRun: time.Unix(1470000000, 0),
+		},
+		{
+			result: CheckResult{
+				Check: Check{
+					ID:          "other",
+					Description: "Other check",
+					Query:       "SELECT * FROM tbl;",
+				},
+				Duration: 20 * time.Millisecond,
+			},
+			lastRun: time.Unix(1470000060, 0),
+		},
+	}
+	expectedContent := `# HELP db_checker_check_problems Number of problems found by check.
+# TYPE db_checker_check_problems gauge
+db_checker_check_problems{id="mismatch",check="Mismatch between \"tbl_one\" and tbl_two",database="movies"} 2
+db_checker_check_problems{id="other",check="Other check",database="movies"} 0
+# HELP db_checker_check_success Whether check passed (1) or failed (0).
+# TYPE db_checker_check_success gauge
+db_checker_check_success{id="mismatch",check="Mismatch between \"tbl_one\" and tbl_two",database="movies"} 0
+db_checker_check_success{id="other",check="Other check",database="movies"} 1
+# HELP db_checker_check_state Nagios state of check: 0 - OK, 1 - WARNING, 2 - CRITICAL, 3 - UNKNOWN.
+# TYPE db_checker_check_state gauge
+db_checker_check_state{id="mismatch",check="Mismatch between \"tbl_one\" and tbl_two",database="movies"} 1
+db_checker_check_state{id="other",check="Other check",database="movies"} 0
+# HELP db_checker_check_duration_seconds Duration of check query in seconds.
+# TYPE db_checker_check_duration_seconds gauge
+db_checker_check_duration_seconds{id="mismatch",check="Mismatch between \"tbl_one\" and tbl_two",database="movies"} 1.5
+db_checker_check_duration_seconds{id="other",check="Other check",database="movies"} 0.02
+# HELP db_checker_check_last_run_timestamp_seconds Unix time of the last check run.
+# TYPE db_checker_check_last_run_timestamp_seconds gauge
+db_checker_check_last_run_timestamp_seconds{id="mismatch",check="Mismatch between \"tbl_one\" and tbl_two",database="movies"} 1470000000
+db_checker_check_last_run_timestamp_seconds{id="other",check="Other check",database="movies"} 1470000060
+`
+	var gotBytes bytes.Buffer
+	if err := writeMetrics(&gotBytes, results, "movies"); err != nil {
+		t.Fatalf("Got error %v on writing metrics", err)
+	}
+	gotContent := gotBytes.String()
+	if expectedContent != gotContent {
+		t.Errorf(
+			"Diff between actual and expected metrics:\n'%v'",
+			DiffPretty(gotContent, expectedContent),
+		)
+	}
+}
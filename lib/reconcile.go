@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CheckQueryReconcile is a checker function that compares output of check query on db
+// with output of compare query on compareDB. Rows are matched by key columns if they are set,
+// by position if tolerance is set, or exactly in any order otherwise.
+// Names of both sides are used to label problem rows.
+func CheckQueryReconcile(ctx context.Context, db, compareDB Querier, check Check, name, compareName string) (*CheckResult, error) {
+	cols, rows, err := queryAllRows(ctx, db, check.Query)
+	if err != nil {
+		return nil, err
+	}
+	compareQuery := check.CompareQuery
+	if compareQuery == "" {
+		compareQuery = check.Query
+	}
+	compareCols, compareRows, err := queryAllRows(ctx, compareDB, compareQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", compareName, err)
+	}
+	result := &CheckResult{Check: check}
+	if len(cols) != len(compareCols) {
+		result.Message = fmt.Sprintf("Columns differ, %s has %s, %s has %s",
+			name, strings.Join(cols, ", "), compareName, strings.Join(compareCols, ", "))
+		return result, nil
+	}
+
+	r := reconciliation{tolerance: check.Tolerance}
+	switch {
+	case len(check.KeyColumns) > 0:
+		keys, err := columnIndexes(cols, check.KeyColumns)
+		if err != nil {
+			return nil, err
+		}
+		r.byKey(keys, rows, compareRows)
+	case check.Tolerance > 0:
+		r.byPosition(rows, compareRows)
+	default:
+		r.onlyFirst = DiffRows(compareRows, rows)
+		r.onlySecond = DiffRows(rows, compareRows)
+	}
+	if r.empty() {
+		return result, nil
+	}
+
+	result.Message = fmt.Sprintf("Results differ, %d rows only in %s, %d rows only in %s, %d rows differ",
+		len(r.onlyFirst), name, len(r.onlySecond), compareName, len(r.differ))
+	result.Columns = append([]string{"diff"}, cols...)
+	for _, row := range r.onlyFirst {
+		result.Problems = append(result.Problems, append(TextRow("only in "+name), row...))
+	}
+	for _, row := range r.onlySecond {
+		result.Problems = append(result.Problems, append(TextRow("only in "+compareName), row...))
+	}
+	for _, pair := range r.differ {
+		result.Problems = append(result.Problems,
+			append(TextRow("differs in "+name), pair[0]...),
+			append(TextRow("differs in "+compareName), pair[1]...),
+		)
+	}
+	return result, nil
+}
+
+// queryAllRows runs query and reads all its rows
+func queryAllRows(ctx context.Context, db Querier, query string) ([]string, []Row, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	cols, results, _, err := scanRows(rows, 0)
+	return cols, results, err
+}
+
+// columnIndexes finds positions of names in columns, ignoring case
+func columnIndexes(columns, names []string) ([]int, error) {
+	var indexes []int
+	for _, name := range names {
+		found := false
+		for i, c := range columns {
+			if strings.EqualFold(c, name) {
+				indexes = append(indexes, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key column %s not found in %s", name, strings.Join(columns, ", "))
+		}
+	}
+	return indexes, nil
+}
+
+// reconciliation collects differences between two sets of rows
+type reconciliation struct {
+	tolerance  float64
+	onlyFirst  []Row
+	onlySecond []Row
+	differ     [][2]Row
+}
+
+func (r *reconciliation) empty() bool {
+	return len(r.onlyFirst) == 0 && len(r.onlySecond) == 0 && len(r.differ) == 0
+}
+
+// compare adds pair of rows to differences if their values don't match
+func (r *reconciliation) compare(first, second Row) {
+	if !rowsMatch(first, second, r.tolerance) {
+		r.differ = append(r.differ, [2]Row{first, second})
+	}
+}
+
+// byKey matches rows with the same values of key columns
+func (r *reconciliation) byKey(keys []int, first, second []Row) {
+	keyOf := func(row Row) string {
+		var key Row
+		for _, i := range keys {
+			if i < len(row) {
+				key = append(key, row[i])
+			}
+		}
+		return key.key()
+	}
+	pending := make(map[string][]int)
+	for i, row := range second {
+		k := keyOf(row)
+		pending[k] = append(pending[k], i)
+	}
+	matched := make([]bool, len(second))
+	for _, row := range first {
+		k := keyOf(row)
+		if len(pending[k]) == 0 {
+			r.onlyFirst = append(r.onlyFirst, row)
+			continue
+		}
+		i := pending[k][0]
+		pending[k] = pending[k][1:]
+		matched[i] = true
+		r.compare(row, second[i])
+	}
+	for i, row := range second {
+		if !matched[i] {
+			r.onlySecond = append(r.onlySecond, row)
+		}
+	}
+}
+
+// byPosition matches rows in order they were returned
+func (r *reconciliation) byPosition(first, second []Row) {
+	for i := 0; i < len(first) || i < len(second); i++ {
+		switch {
+		case i >= len(second):
+			r.onlyFirst = append(r.onlyFirst, first[i])
+		case i >= len(first):
+			r.onlySecond = append(r.onlySecond, second[i])
+		default:
+			r.compare(first[i], second[i])
+		}
+	}
+}
+
+// rowsMatch checks if rows have equal values, numbers could differ within tolerance
+func rowsMatch(first, second Row, tolerance float64) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i, c := range first {
+		if eqCell(c, second[i]) {
+			continue
+		}
+		x, okx := toNumber(cellValue(c))
+		y, oky := toNumber(cellValue(second[i]))
+		if !okx || !oky || math.Abs(x-y) > tolerance {
+			return false
+		}
+	}
+	return true
+}
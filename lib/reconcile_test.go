@@ -0,0 +1,187 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCheckQueryReconcile(t *testing.T) {
+	columns := []string{"day", "orders", "total"}
+	cases := []struct {
+		name        string
+		check       Check
+		rows        string
+		compareRows string
+		expected    CheckResult
+	}{
+		{
+			"exact match in any order",
+			Check{},
+			"2019-01-01,10,100.5\n2019-01-02,5,20",
+			"2019-01-02,5,20\n2019-01-01,10,100.5",
+			CheckResult{},
+		},
+		{
+			"exact mismatch",
+			Check{},
+			"2019-01-01,10,100.5\n2019-01-02,5,20",
+			"2019-01-01,10,100.5\n2019-01-02,5,21",
+			CheckResult{
+				Message: "Results differ, 1 rows only in primary, 1 rows only in warehouse, 0 rows differ",
+				Columns: []string{"diff", "day", "orders", "total"},
+				Problems: []Row{
+					TextRow("only in primary", "2019-01-02", "5", "20"),
+					TextRow("only in warehouse", "2019-01-02", "5", "21"),
+				},
+			},
+		},
+		{
+			"by key columns",
+			Check{KeyColumns: []string{"DAY"}},
+			"2019-01-01,10,100.5\n2019-01-02,5,20\n2019-01-03,1,1",
+			"2019-01-02,5,21\n2019-01-01,10,100.50\n2019-01-04,2,2",
+			CheckResult{
+				Message: "Results differ, 1 rows only in primary, 1 rows only in warehouse, 1 rows differ",
+				Columns: []string{"diff", "day", "orders", "total"},
+				Problems: []Row{
+					TextRow("only in primary", "2019-01-03", "1", "1"),
+					TextRow("only in warehouse", "2019-01-04", "2", "2"),
+					TextRow("differs in primary", "2019-01-02", "5", "20"),
+					TextRow("differs in warehouse", "2019-01-02", "5", "21"),
+				},
+			},
+		},
+		{
+			"within tolerance",
+			Check{Tolerance: 0.5},
+			"2019-01-01,10,100.5",
+			"2019-01-01,10,100.1",
+			CheckResult{},
+		},
+		{
+			"out of tolerance",
+			Check{Tolerance: 0.1},
+			"2019-01-01,10,100.5",
+			"2019-01-01,10,100.1",
+			CheckResult{
+				Message: "Results differ, 0 rows only in primary, 0 rows only in warehouse, 1 rows differ",
+				Columns: []string{"diff", "day", "orders", "total"},
+				Problems: []Row{
+					TextRow("differs in primary", "2019-01-01", "10", "100.5"),
+					TextRow("differs in warehouse", "2019-01-01", "10", "100.1"),
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		compareDB, compareMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+		mock.ExpectQuery(`SELECT day, orders, total FROM daily_orders`).
+			WillReturnRows(sqlmock.NewRows(columns).FromCSVString(c.rows))
+		compareMock.ExpectQuery(`SELECT day, orders, total FROM dwh.daily_orders`).
+			WillReturnRows(sqlmock.NewRows(columns).FromCSVString(c.compareRows))
+
+		check := c.check
+		check.Description = "Orders match warehouse"
+		check.Query = "SELECT day, orders, total FROM daily_orders"
+		check.CompareQuery = "SELECT day, orders, total FROM dwh.daily_orders"
+		check.CompareTarget = "warehouse"
+		check.Assert = "reconcile"
+		result, err := CheckQueryReconcile(context.Background(), db, compareDB, check, "primary", "warehouse")
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got %s instead", c.name, err)
+		}
+		c.expected.Check = check
+		if !eqResult(*result, c.expected) {
+			t.Errorf("%s: expected result %v, got %v", c.name, c.expected, *result)
+		}
+		for _, m := range []sqlmock.Sqlmock{mock, compareMock} {
+			if err := m.ExpectationsWereMet(); err != nil {
+				t.Errorf("%s: there were unfulfilled expections: %s", c.name, err)
+			}
+		}
+		db.Close()
+		compareDB.Close()
+	}
+}
+
+func TestRunChecksReconcile(t *testing.T) {
+	db1, mock1, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db1.Close()
+	db2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db2.Close()
+
+	checks := []*Check{
+		{
+			Description:   "Orders count match warehouse",
+			Query:         "SELECT count(*) FROM orders",
+			Assert:        "reconcile",
+			CompareTarget: "warehouse",
+		},
+		{
+			Description:   "Orders match archive",
+			Query:         "SELECT count(*) FROM orders",
+			Assert:        "reconcile",
+			CompareTarget: "archive",
+			Targets:       []string{"primary"},
+		},
+	}
+	conns := []*connection{
+		{target: Target{Name: "primary"}, db: db1},
+		{target: Target{Name: "warehouse"}, db: db2},
+	}
+	mock1.ExpectBegin()
+	mock2.ExpectBegin()
+	mock1.ExpectQuery(`SELECT count`).WillReturnRows(sqlmock.NewRows([]string{"count"}).FromCSVString("10"))
+	mock2.ExpectQuery(`SELECT count`).WillReturnRows(sqlmock.NewRows([]string{"count"}).FromCSVString("9"))
+	mock2.ExpectRollback()
+	mock1.ExpectRollback()
+
+	results := runJobs(makeJobs(conns, checks), RunOptions{Concurrency: 1, ProblemState: StateCritical})
+	expectedResult := []CheckResult{
+		{
+			Check:   *checks[0],
+			Message: "Results differ, 1 rows only in primary, 1 rows only in warehouse, 0 rows differ",
+			Columns: []string{"diff", "count"},
+			Problems: []Row{
+				TextRow("only in primary", "10"),
+				TextRow("only in warehouse", "9"),
+			},
+			State:  StateCritical,
+			Target: "primary",
+		},
+		{
+			Check:    *checks[1],
+			Problems: []Row{TextRow("Compare target archive not found")},
+			State:    StateCritical,
+			Target:   "primary",
+		},
+	}
+	if len(results) != len(expectedResult) {
+		t.Fatalf("Expected %d results, got %d: %v", len(expectedResult), len(results), results)
+	}
+	for _, r := range expectedResult {
+		if !ResultInSlice(r, results) {
+			t.Errorf("Expected to find %v in results %v", r, results)
+		}
+	}
+	for _, m := range []sqlmock.Sqlmock{mock1, mock2} {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expections: %s", err)
+		}
+	}
+}
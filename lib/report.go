@@ -7,24 +7,44 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"text/tabwriter"
 )
 
-// ReportProblems counts and pretty print problems
+// byState sorts CheckResults from the most severe State to the least severe
+type byState []CheckResult
+
+func (s byState) Len() int           { return len(s) }
+func (s byState) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byState) Less(i, j int) bool { return s[i].State > s[j].State }
+
+// ReportProblems counts and pretty print problems,
+// grouped by State from the most severe one
 func ReportProblems(results []CheckResult) (int, string) {
+	sorted := make([]CheckResult, len(results))
+	copy(sorted, results)
+	sort.Stable(byState(sorted))
 	w := new(tabwriter.Writer)
 	var buffer *bytes.Buffer
 	count := 0
 	prettyCount := 0
 	report := ""
 	prettyNumbers := false
-	for _, cr := range results {
+	for _, cr := range sorted {
 		buffer = new(bytes.Buffer)
 		w.Init(buffer, 1, 1, 0, ' ', 0)
 		prettyCount = 0
 		prettyNumbers = false
 		if cr.HasProblems() {
-			report += "\n* " + cr.Check.Description + "\n"
+			if cr.Target != "" {
+				report += fmt.Sprintf("\n* [%v] %s: %s\n", cr.State, cr.Target, cr.Check.Description)
+			} else {
+				report += fmt.Sprintf("\n* [%v] %s\n", cr.State, cr.Check.Description)
+			}
+			if cr.Message != "" {
+				fmt.Fprintf(w, "%s\n", cr.Message)
+			}
+			count += cr.ProblemsCount() - len(cr.Problems)
 			if len(cr.Columns) != 0 {
 				prettyNumbers = true
 				fmt.Fprintf(w, "N. \t¦ %s\n", ToTabString(cr.Columns))
@@ -7,28 +7,30 @@ import (
 )
 
 var t1 = "2015-08-10 11:42:50.641621+03"
-var exampleContent = `[{"check":{"Description":"Mismatch between tbl_one and tbl_two","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["181620","4","15"],["236695","2","30"]],"columns":["ID","F","S"]},{"check":{"Description":"Other check","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["181620","-200","2015-08-10 11:42:50.641621+03"]],"columns":["user_id","balance","date"]},{"check":{"Description":"Another check","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["Warner Bros. Entertainment, Inc.","Interview with the Vampire: The Vampire Chronicles","vampire","2015-08-10 11:42:50.641621+03"],["Sony Pictures","Repentance","some-slug","2015-08-10 11:42:50.641621+03"]],"columns":["rightsholder","title","slug","date"]}]`
+var exampleContent = `[{"check":{"Description":"Mismatch between tbl_one and tbl_two","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["181620","4","15"],["236695","2","30"]],"columns":["ID","F","S"],"state":"WARNING"},{"check":{"Description":"Other check","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["181620","-200","2015-08-10 11:42:50.641621+03"]],"columns":["user_id","balance","date"],"state":"WARNING"},{"check":{"Description":"Another check","Query":"SELECT * FROM tbl;","Assert":""},"problems":[["Warner Bros. Entertainment, Inc.","Interview with the Vampire: The Vampire Chronicles","vampire","2015-08-10 11:42:50.641621+03"],["Sony Pictures","Repentance","some-slug","2015-08-10 11:42:50.641621+03"]],"columns":["rightsholder","title","slug","date"],"state":"CRITICAL"}]`
 var exampleCheckResults = []CheckResult{
 	{
 		Check: Check{
 			Description: "Mismatch between tbl_one and tbl_two",
 			Query:       "SELECT * FROM tbl;",
 		},
-		Columns: Row{"ID", "F", "S"},
+		Columns: []string{"ID", "F", "S"},
 		Problems: []Row{
-			{"181620", "4", "15"},
-			{"236695", "2", "30"},
+			TextRow("181620", "4", "15"),
+			TextRow("236695", "2", "30"),
 		},
+		State: StateWarning,
 	},
 	{
 		Check: Check{
 			Description: "Other check",
 			Query:       "SELECT * FROM tbl;",
 		},
-		Columns: Row{"user_id", "balance", "date"},
+		Columns: []string{"user_id", "balance", "date"},
 		Problems: []Row{
-			{"181620", "-200", t1},
+			TextRow("181620", "-200", t1),
 		},
+		State: StateWarning,
 	},
 	{
 
@@ -36,11 +38,12 @@ var exampleCheckResults = []CheckResult{
 			Description: "Another check",
 			Query:       "SELECT * FROM tbl;",
 		},
-		Columns: Row{"rightsholder", "title", "slug", "date"},
+		Columns: []string{"rightsholder", "title", "slug", "date"},
 		Problems: []Row{
-			{"Warner Bros. Entertainment, Inc.", "Interview with the Vampire: The Vampire Chronicles", "vampire", t1},
-			{"Sony Pictures", "Repentance", "some-slug", t1},
+			TextRow("Warner Bros. Entertainment, Inc.", "Interview with the Vampire: The Vampire Chronicles", "vampire", t1),
+			TextRow("Sony Pictures", "Repentance", "some-slug", t1),
 		},
+		State: StateCritical,
 	},
 }
 
@@ -53,19 +56,19 @@ func TestReportProblems(t *testing.T) {
 	}
 
 	expectedReport := `
-* Mismatch between tbl_one and tbl_two
+* [CRITICAL] Another check
+N. ¦ rightsholder                     ¦ title                                              ¦ slug      ¦ date
+1. ¦ Warner Bros. Entertainment, Inc. ¦ Interview with the Vampire: The Vampire Chronicles ¦ vampire   ¦ ` + t1 + `
+2. ¦ Sony Pictures                    ¦ Repentance                                         ¦ some-slug ¦ ` + t1 + `
+
+* [WARNING] Mismatch between tbl_one and tbl_two
 N. ¦ ID     ¦ F ¦ S
 1. ¦ 181620 ¦ 4 ¦ 15
 2. ¦ 236695 ¦ 2 ¦ 30
 
-* Other check
+* [WARNING] Other check
 N. ¦ user_id ¦ balance ¦ date
 1. ¦ 181620  ¦ -200    ¦ ` + t1 + `
-
-* Another check
-N. ¦ rightsholder                     ¦ title                                              ¦ slug      ¦ date
-1. ¦ Warner Bros. Entertainment, Inc. ¦ Interview with the Vampire: The Vampire Chronicles ¦ vampire   ¦ ` + t1 + `
-2. ¦ Sony Pictures                    ¦ Repentance                                         ¦ some-slug ¦ ` + t1 + `
 `
 
 	if gotReport != expectedReport {
@@ -111,3 +114,40 @@ func TestReadReport(t *testing.T) {
 		}
 	}
 }
+
+func TestReportProblemsMessage(t *testing.T) {
+	results := []CheckResult{
+		{
+			Check:    Check{Description: "Active workers"},
+			Message:  "Returned 2 rows, expected at least 3",
+			Columns:  []string{"id"},
+			Problems: []Row{TextRow("1"), TextRow("2")},
+			State:    StateWarning,
+		},
+		{
+			Check:   Check{Description: "Running jobs"},
+			Message: "Returned 0 rows, expected at least 1",
+			State:   StateCritical,
+		},
+	}
+	gotCount, gotReport := ReportProblems(results)
+	if gotCount != 3 {
+		t.Errorf("Expected 3 problems, got %d", gotCount)
+	}
+	expectedReport := `
+* [CRITICAL] Running jobs
+Returned 0 rows, expected at least 1
+
+* [WARNING] Active workers
+Returned 2 rows, expected at least 3
+N. ¦ id
+1. ¦ 1
+2. ¦ 2
+`
+	if gotReport != expectedReport {
+		t.Errorf(
+			"Diff between actual and expected reports:\n'%v'",
+			DiffPretty(gotReport, expectedReport),
+		)
+	}
+}
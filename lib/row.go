@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Cell is a single value from DB query
+type Cell struct {
+	// Value is nil for NULL, otherwise one of
+	// int64, uint64, float64, bool, time.Time, string or []byte
+	Value interface{}
+	// text is original text form of Value parsed from driver output
+	text string
+}
+
+// IsNull indicates that Cell holds NULL
+func (c Cell) IsNull() bool {
+	return c.Value == nil
+}
+
+// String returns text form of Cell value, or NULL.
+// Text form is the same as database/sql produces when scanning into string,
+// so it matches values in reports created before typed cells.
+func (c Cell) String() string {
+	if c.text != "" {
+		return c.text
+	}
+	switch v := c.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// MarshalJSON represents Cell as JSON string, or null for NULL
+func (c Cell) MarshalJSON() ([]byte, error) {
+	if c.IsNull() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(c.String())
+}
+
+// UnmarshalJSON reads Cell from JSON string or null
+func (c *Cell) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil {
+		*c = Cell{}
+	} else {
+		*c = Cell{Value: *s}
+	}
+	return nil
+}
+
+// MarshalYAML represents Cell as YAML string, or null for NULL
+func (c Cell) MarshalYAML() (interface{}, error) {
+	if c.IsNull() {
+		return nil, nil
+	}
+	return c.String(), nil
+}
+
+// UnmarshalYAML reads Cell from YAML scalar, null is read as NULL
+func (c *Cell) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s *string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if s == nil {
+		*c = Cell{}
+	} else {
+		*c = Cell{Value: *s}
+	}
+	return nil
+}
+
+// eqCell checks if two Cells are equal by their text form
+func eqCell(first, second Cell) bool {
+	return first.IsNull() == second.IsNull() && first.String() == second.String()
+}
+
+// Row is a row of values from DB query
+type Row []Cell
+
+// TextRow creates Row of text values
+func TextRow(values ...string) Row {
+	row := make(Row, len(values))
+	for i, v := range values {
+		row[i] = Cell{Value: v}
+	}
+	return row
+}
+
+// Strings returns text forms of Row values
+func (r Row) Strings() []string {
+	result := make([]string, len(r))
+	for i, c := range r {
+		result[i] = c.String()
+	}
+	return result
+}
+
+func (r Row) String() string {
+	return ToTabString(r.Strings())
+}
+
+// key returns Row representation used for comparison,
+// which is unlike String distinguishes NULL from 'NULL' text
+func (r Row) key() string {
+	var list []string
+	for _, c := range r {
+		if c.IsNull() {
+			list = append(list, "NULL")
+		} else {
+			list = append(list, strconv.Quote(strings.TrimSpace(c.String())))
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// legacyKey returns Row representation used for comparison with rows
+// of old reports, where NULL was stored as empty string
+func (r Row) legacyKey() string {
+	row := make(Row, len(r))
+	for i, c := range r {
+		if c.IsNull() {
+			c = Cell{Value: ""}
+		}
+		row[i] = c
+	}
+	return row.key()
+}
+
+// scanTypeKinds maps nullable scan types to kinds of their values
+var scanTypeKinds = map[reflect.Type]reflect.Kind{
+	reflect.TypeOf(sql.NullInt64{}):   reflect.Int64,
+	reflect.TypeOf(sql.NullFloat64{}): reflect.Float64,
+	reflect.TypeOf(sql.NullBool{}):    reflect.Bool,
+}
+
+// scanKind returns kind of values in column, or reflect.Invalid if it is unknown
+func scanKind(ct *sql.ColumnType) reflect.Kind {
+	if ct == nil || ct.ScanType() == nil {
+		return reflect.Invalid
+	}
+	if kind, ok := scanTypeKinds[ct.ScanType()]; ok {
+		return kind
+	}
+	return ct.ScanType().Kind()
+}
+
+// newCell creates Cell from value scanned from column,
+// values in text form are parsed according to column type
+func newCell(value interface{}, ct *sql.ColumnType) Cell {
+	b, ok := value.([]byte)
+	if !ok {
+		return Cell{Value: value}
+	}
+	text := string(b)
+	var parsed interface{}
+	var err error
+	switch scanKind(ct) {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err = strconv.ParseInt(text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err = strconv.ParseUint(text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		parsed, err = strconv.ParseFloat(text, 64)
+	case reflect.Bool:
+		parsed, err = strconv.ParseBool(text)
+	default:
+		err = strconv.ErrSyntax
+	}
+	switch {
+	case err == nil:
+		return Cell{Value: parsed, text: text}
+	case utf8.Valid(b):
+		return Cell{Value: text}
+	default:
+		return Cell{Value: b}
+	}
+}
+
+// scanRows reads column names and rows from rows, returning total number of rows.
+// Only first limit rows are kept, zero limit means no limit.
+func scanRows(rows *sql.Rows, limit int) ([]string, []Row, int, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	cols := make([]string, len(types))
+	for i, ct := range types {
+		cols[i] = ct.Name()
+	}
+	values := make([]interface{}, len(types))
+	fields := make([]interface{}, len(types))
+	for i := range values {
+		fields[i] = &values[i]
+	}
+	var results []Row
+	count := 0
+	for rows.Next() {
+		count++
+		if limit > 0 && len(results) >= limit {
+			continue
+		}
+		if err := rows.Scan(fields...); err != nil {
+			Error.Println(err)
+			continue
+		}
+		row := make(Row, len(values))
+		for i, v := range values {
+			row[i] = newCell(v, types[i])
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+	return cols, results, count, nil
+}
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCellString(t *testing.T) {
+	ts := time.Date(2016, 4, 14, 16, 16, 57, 0, time.UTC)
+	cases := []struct {
+		cell     Cell
+		expected string
+	}{
+		{Cell{}, "NULL"},
+		{Cell{Value: ""}, ""},
+		{Cell{Value: "OK"}, "OK"},
+		{Cell{Value: []byte("OK")}, "OK"},
+		{Cell{Value: int64(-200)}, "-200"},
+		{Cell{Value: 1.5}, "1.5"},
+		{Cell{Value: true}, "true"},
+		{Cell{Value: ts}, "2016-04-14T16:16:57Z"},
+		{newCell([]byte("15.50"), nil), "15.50"},
+	}
+	for _, c := range cases {
+		if got := c.cell.String(); got != c.expected {
+			t.Errorf("Expected %v to be %q, got %q", c.cell.Value, c.expected, got)
+		}
+	}
+}
+
+func TestCellJSON(t *testing.T) {
+	row := Row{Cell{Value: int64(1)}, Cell{}, Cell{Value: ""}}
+	b, err := json.Marshal(row)
+	if err != nil {
+		t.Fatalf("Failed to marshal row: %v", err)
+	}
+	if string(b) != `["1",null,""]` {
+		t.Errorf("Unexpected JSON for row: %s", b)
+	}
+	var got Row
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Failed to unmarshal row: %v", err)
+	}
+	if !eqRow(got, row) {
+		t.Errorf("Expected %v, got %v", row, got)
+	}
+	if eqRow(got, TextRow("1", "", "")) {
+		t.Error("Expected NULL to differ from empty string")
+	}
+}
+
+func TestDiffRowsNull(t *testing.T) {
+	first := []Row{TextRow("1", "NULL")}
+	second := []Row{{Cell{Value: "1"}, Cell{}}}
+	if diff := DiffRows(first, second); len(diff) != 1 {
+		t.Errorf("Expected NULL to differ from 'NULL' text, got diff %v", diff)
+	}
+}
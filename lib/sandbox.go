@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// runInTx runs checker in a transaction which is always rolled back.
+// Transaction is read-only unless allowWrites is set, driver d
+// could be nil for DB of unknown type.
+func runInTx(ctx context.Context, db *sql.DB, d *Driver, checker CheckFunc, check Check, allowWrites bool) (*CheckResult, error) {
+	readOnly := !allowWrites
+	if d == nil {
+		d = &Driver{ReadOnlyTx: true}
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly && d.ReadOnlyTx})
+	if err != nil {
+		return nil, err
+	}
+	// we never commit anything checks do
+	defer tx.Rollback()
+	if readOnly {
+		for _, stmt := range d.ReadOnlySetup {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cr, err := checker(ctx, tx, check)
+	if err != nil && d.IsReadOnlyError != nil && d.IsReadOnlyError(err) {
+		return nil, fmt.Errorf("check tried to write to read-only database, writes are not allowed: %v", err)
+	}
+	return cr, err
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestRunInTxReadOnly(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	check := Check{
+		Description: "some_table empty",
+		Query:       "SELECT id, some_col FROM some_table",
+		Assert:      "absent",
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET TRANSACTION READ ONLY`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "some_col"}))
+	mock.ExpectRollback()
+
+	result, err := runInTx(context.Background(), db, drivers["postgres"], CheckQueryAbsent, check, false)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+	if result.HasProblems() {
+		t.Error("Expected result to have no problems")
+	}
+}
+
+func TestRunInTxWrite(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	check := Check{
+		Description: "cleanup",
+		Query:       "DELETE FROM some_table RETURNING id",
+		Assert:      "absent",
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET TRANSACTION READ ONLY`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`DELETE FROM some_table`).
+		WillReturnError(&pq.Error{Code: "25006", Message: "cannot execute DELETE in a read-only transaction"})
+	mock.ExpectRollback()
+
+	_, err = runInTx(context.Background(), db, drivers["postgres"], CheckQueryAbsent, check, false)
+	if err == nil {
+		t.Fatal("Expected write in read-only transaction to fail")
+	}
+	if !strings.Contains(err.Error(), "writes are not allowed") {
+		t.Errorf("Expected error to explain that writes are not allowed, got %v", err)
+	}
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+func TestRunInTxAllowWrites(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	check := Check{
+		Description: "cleanup",
+		Query:       "DELETE FROM some_table RETURNING id",
+		Assert:      "absent",
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM some_table`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	_, err = runInTx(context.Background(), db, drivers["postgres"], CheckQueryAbsent, check, true)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is used for checks without own interval
+// when Scheduler has no valid interval
+const DefaultInterval = time.Minute
+
+// Scheduler runs checks on their intervals over long-living DB connection pools,
+// and keeps latest result of each check
+type Scheduler struct {
+	conns    []*connection
+	jobs     []job
+	interval time.Duration
+	opts     RunOptions
+
+	mu      sync.RWMutex
+	results []*scheduledResult
+}
+
+// scheduledResult is a latest result of check with time of its run
+type scheduledResult struct {
+	result  CheckResult
+	lastRun time.Time
+}
+
+// NewScheduler creates Scheduler for checks against all targets they apply to.
+// Checks without own interval are run every interval.
+func NewScheduler(targets []Target, checks []*Check, interval time.Duration, opts RunOptions) (*Scheduler, error) {
+	conns, err := openConnections(targets)
+	if err != nil {
+		return nil, err
+	}
+	return newScheduler(conns, checks, interval, opts), nil
+}
+
+func newScheduler(conns []*connection, checks []*Check, interval time.Duration, opts RunOptions) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	jobs := makeJobs(conns, checks)
+	return &Scheduler{
+		conns:    conns,
+		jobs:     jobs,
+		interval: interval,
+		opts:     opts,
+		results:  make([]*scheduledResult, len(jobs)),
+	}
+}
+
+// Run runs all checks on their intervals until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	concurrency := s.opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// use this channel as a semaphore to limit concurrency
+	sem := make(chan bool, concurrency)
+	var wg sync.WaitGroup
+	for i, j := range s.jobs {
+		wg.Add(1)
+		go func(pos int, j job) {
+			defer wg.Done()
+			interval := j.check.Interval
+			if interval <= 0 {
+				interval = s.interval
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case sem <- true:
+					lastRun := time.Now()
+					cr := runCheck(j, s.opts)
+					<-sem
+					s.setResult(pos, &scheduledResult{result: *cr, lastRun: lastRun})
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) setResult(pos int, sr *scheduledResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[pos] = sr
+}
+
+// scheduledResults returns latest results of checks which were run at least once
+func (s *Scheduler) scheduledResults() []scheduledResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var results []scheduledResult
+	for _, sr := range s.results {
+		if sr != nil {
+			results = append(results, *sr)
+		}
+	}
+	return results
+}
+
+// Results returns latest results of checks which were run at least once
+func (s *Scheduler) Results() []CheckResult {
+	var results []CheckResult
+	for _, sr := range s.scheduledResults() {
+		results = append(results, sr.result)
+	}
+	return results
+}
+
+// Close closes DB connection pools
+func (s *Scheduler) Close() {
+	closeConnections(s.conns)
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSchedulerRun(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	checks := []*Check{
+		{
+			Description: "some_table empty",
+			Query:       "SELECT id, some_col FROM some_table",
+			Assert:      "absent",
+		},
+		{
+			Description: "other_table non-empty",
+			Query:       "SELECT id, other_col FROM other_table",
+			Assert:      "present",
+			Interval:    time.Hour,
+		},
+	}
+	// match query it with regexp, each check runs in own transaction
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, some_col FROM some_table`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "some_col"}).FromCSVString("1, OK"))
+	mock.ExpectQuery(`SELECT id, other_col FROM other_table`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "other_col"}).FromCSVString("1, OK"))
+	mock.ExpectRollback()
+	mock.ExpectRollback()
+
+	conns := []*connection{{db: db}}
+	s := newScheduler(conns, checks, time.Hour, RunOptions{Concurrency: 1, ProblemState: StateWarning})
+	if len(s.Results()) != 0 {
+		t.Fatal("Expected no results before scheduler run")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(s.Results()) < len(checks) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	results := s.Results()
+	if len(results) != len(checks) {
+		t.Fatalf("Expected %d results, got %d", len(checks), len(results))
+	}
+	expectedResult := CheckResult{
+		Check:   *checks[0],
+		Columns: []string{"id", "some_col"},
+		Problems: []Row{
+			TextRow("1", "OK"),
+		},
+		State: StateWarning,
+	}
+	if !eqResult(results[0], expectedResult) {
+		t.Errorf("Expected result %v, got %v", expectedResult, results[0])
+	}
+	if results[1].HasProblems() {
+		t.Errorf("Expected result to have no problems, got %v", results[1])
+	}
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
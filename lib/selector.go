@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+)
+
+// Selector selects checks to run by their tags and IDs
+type Selector struct {
+	// Tags selects checks having any of tags, all checks if empty
+	Tags []string
+	// ExcludeTags skips checks having any of tags
+	ExcludeTags []string
+	// Only selects checks with IDs matching any of glob patterns, all checks if empty
+	Only []string
+}
+
+// IsEmpty indicates that Selector selects all checks
+func (s Selector) IsEmpty() bool {
+	return len(s.Tags) == 0 && len(s.ExcludeTags) == 0 && len(s.Only) == 0
+}
+
+// Validate checks that Selector has valid glob patterns
+func (s Selector) Validate() error {
+	for _, pattern := range s.Only {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad check ID pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match checks if Check is selected
+func (s Selector) Match(c Check) bool {
+	// tags of broken check are unknown, so it is selected by IDs only
+	if len(s.Tags) > 0 && !c.hasTag(s.Tags) && c.LoadError == "" {
+		return false
+	}
+	if c.hasTag(s.ExcludeTags) {
+		return false
+	}
+	if len(s.Only) == 0 {
+		return true
+	}
+	for _, pattern := range s.Only {
+		if ok, _ := path.Match(pattern, c.ID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectChecks returns checks selected by Selector and number of skipped checks
+func SelectChecks(checks []*Check, s Selector) ([]*Check, int) {
+	var selected []*Check
+	for _, c := range checks {
+		if s.Match(*c) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, len(checks) - len(selected)
+}
+
+// hasTag checks if Check has any of tags
+func (c Check) hasTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, ct := range c.Tags {
+			if tag == ct {
+				return true
+			}
+		}
+	}
+	return false
+}
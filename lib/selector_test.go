@@ -0,0 +1,40 @@
+package lib
+
+import "testing"
+
+func TestSelectChecks(t *testing.T) {
+	checks := []*Check{
+		{ID: "billing/invoices", Tags: []string{"billing", "daily"}},
+		{ID: "billing/payments", Tags: []string{"billing", "slow"}},
+		{ID: "users/locks", Tags: []string{"core"}},
+		{ID: "replication"},
+	}
+	cases := []struct {
+		selector Selector
+		expected []string
+	}{
+		{Selector{}, []string{"billing/invoices", "billing/payments", "users/locks", "replication"}},
+		{Selector{Tags: []string{"billing", "core"}}, []string{"billing/invoices", "billing/payments", "users/locks"}},
+		{Selector{ExcludeTags: []string{"slow"}}, []string{"billing/invoices", "users/locks", "replication"}},
+		{Selector{Tags: []string{"billing"}, ExcludeTags: []string{"slow"}}, []string{"billing/invoices"}},
+		{Selector{Only: []string{"billing/*", "replication"}}, []string{"billing/invoices", "billing/payments", "replication"}},
+		{Selector{Only: []string{"*/locks"}, Tags: []string{"billing"}}, nil},
+	}
+	for _, c := range cases {
+		selected, skipped := SelectChecks(checks, c.selector)
+		var ids []string
+		for _, check := range selected {
+			ids = append(ids, check.ID)
+		}
+		if !eqStrings(ids, c.expected) {
+			t.Errorf("Expected %+v to select %v, got %v", c.selector, c.expected, ids)
+		}
+		if skipped != len(checks)-len(c.expected) {
+			t.Errorf("Expected %+v to skip %d checks, got %d", c.selector, len(checks)-len(c.expected), skipped)
+		}
+	}
+
+	if err := (Selector{Only: []string{"billing/["}}).Validate(); err == nil {
+		t.Error("Expected bad pattern to fail validation")
+	}
+}
@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LoadOptions controls loading of checks
+type LoadOptions struct {
+	// Strict turns files which fail to load into broken checks reported as UNKNOWN,
+	// otherwise such files are only logged and skipped
+	Strict bool
+	// Include are glob patterns of files to load from directories, all files are loaded if empty
+	Include []string
+	// Exclude are glob patterns of files and directories to skip
+	Exclude []string
+	// FollowSymlinks enables loading of checks from symlinked directories
+	FollowSymlinks bool
+	// Databases are tables with checks, loaded after check files
+	Databases []DBSource
+	// Timeout limits reading of checks from each database, zero means no limit
+	Timeout time.Duration
+}
+
+// Validate checks that include and exclude patterns and databases are valid
+func (o LoadOptions) Validate() error {
+	for _, source := range o.Databases {
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+	}
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad file pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchFile checks if file at rel path matches any of patterns.
+// Patterns with slash are matched against whole path, others against file name only.
+func matchFile(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isCheckFile checks if file could contain checks by its name
+func isCheckFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml" || ext == ".sql"
+}
+
+// checkFile is a check or defaults file found in checks source
+type checkFile struct {
+	// root is a directory of source the file was found in,
+	// IDs of checks are derived from path relative to it
+	root string
+	path string
+}
+
+// fileFinder finds check files in sources
+type fileFinder struct {
+	opts    LoadOptions
+	onError func(root, path string, err error)
+	files   map[string]checkFile
+	// visited are real paths of walked directories, to stop on symlink loops
+	visited map[string]bool
+}
+
+// findCheckFiles returns check and defaults files from sources, which are
+// directories or single files, sorted by path. Include and exclude patterns
+// are applied to files found in directories. Paths which can't be read are reported to onError.
+func findCheckFiles(sources []string, opts LoadOptions, onError func(root, path string, err error)) ([]checkFile, error) {
+	f := &fileFinder{
+		opts:    opts,
+		onError: onError,
+		files:   make(map[string]checkFile),
+		visited: make(map[string]bool),
+	}
+	for _, source := range sources {
+		stat, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		source = filepath.Clean(source)
+		if !stat.IsDir() {
+			f.add(filepath.Dir(source), source)
+			continue
+		}
+		f.walk(source, source)
+	}
+	var files []checkFile
+	for _, cf := range f.files {
+		files = append(files, cf)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
+
+// add adds file found in source with root directory, file found first wins
+func (f *fileFinder) add(root, path string) {
+	if _, ok := f.files[path]; !ok {
+		f.files[path] = checkFile{root: root, path: path}
+	}
+}
+
+// walk adds check files from dir and its subdirectories
+func (f *fileFinder) walk(root, dir string) {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if f.visited[real] {
+			return
+		}
+		f.visited[real] = true
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		f.onError(root, dir, err)
+		return
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		rel, _ := filepath.Rel(root, path)
+		if entry.Mode()&os.ModeSymlink != 0 && f.opts.FollowSymlinks {
+			stat, err := os.Stat(path)
+			if err != nil {
+				f.onError(root, path, err)
+				continue
+			}
+			entry = stat
+		}
+		switch {
+		case matchFile(f.opts.Exclude, rel):
+		case entry.IsDir():
+			f.walk(root, path)
+		case isDefaultsFile(path):
+			f.add(root, path)
+		case isCheckFile(path) && (len(f.opts.Include) == 0 || matchFile(f.opts.Include, rel)):
+			f.add(root, path)
+		}
+	}
+}
+
+// walkCheckFiles calls fn for every check and defaults file from sources,
+// passing defaults of file directory and of its parents up to source root.
+// Paths which fail to load, like unreadable directories or broken defaults files, are reported to onError.
+func walkCheckFiles(sources []string, opts LoadOptions, onError func(root, path string, err error), fn func(f checkFile, d defaultsChain) error) error {
+	files, err := findCheckFiles(sources, opts, onError)
+	if err != nil {
+		return err
+	}
+
+	// defaults of each directory in source root and of its parents
+	dirDefaults := make(map[[2]string]defaultsChain)
+	var defaultsOf func(root, dir string) defaultsChain
+	defaultsOf = func(root, dir string) defaultsChain {
+		if d, ok := dirDefaults[[2]string{root, dir}]; ok {
+			return d
+		}
+		var chain defaultsChain
+		if dir != root && dir != filepath.Dir(dir) {
+			chain = append(chain, defaultsOf(root, filepath.Dir(dir))...)
+		}
+		d, err := readDefaults(dir)
+		if err != nil {
+			onError(root, defaultsPath(dir, err), err)
+		}
+		if d != nil {
+			chain = append(chain, *d)
+		}
+		dirDefaults[[2]string{root, dir}] = chain
+		return chain
+	}
+	for _, f := range files {
+		if err := fn(f, defaultsOf(f.root, filepath.Dir(f.path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryFileSet is a set of query files referenced by checks with query_file field
+type queryFileSet map[string]bool
+
+// absPath returns absolute path, or path itself if it can't be resolved
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func (s queryFileSet) add(paths ...string) {
+	for _, path := range paths {
+		if path != "" {
+			s[absPath(path)] = true
+		}
+	}
+}
+
+func (s queryFileSet) has(path string) bool {
+	return s[absPath(path)]
+}
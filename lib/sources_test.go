@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchFile(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		rel      string
+		expected bool
+	}{
+		{[]string{"*.yml"}, "billing/invoices.yml", true},
+		{[]string{"*_draft.yml"}, "billing/invoices.yml", false},
+		{[]string{"billing/*"}, "billing/invoices.yml", true},
+		{[]string{"billing/*"}, "billing/old/invoices.yml", false},
+		{[]string{"payments/*", "old"}, "billing/old", true},
+		{nil, "billing/invoices.yml", false},
+	}
+	for _, c := range cases {
+		if got := matchFile(c.patterns, c.rel); got != c.expected {
+			t.Errorf("Expected matchFile(%v, %s) to be %v, got %v", c.patterns, c.rel, c.expected, got)
+		}
+	}
+}
+
+func TestLoadChecksSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	check := "description: %s\nquery: SELECT id FROM some_table\nassert: absent\n"
+	files := []string{
+		"shared/replication.yml",
+		"shared/billing/invoices.yml",
+		"shared/billing/invoices_draft.yml",
+		"shared/billing/old/payments.yml",
+		"service/queue.yaml",
+		"service/notes.txt",
+		"extra/orders.yml",
+		"linked/users.yml",
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(check, name)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "linked"), filepath.Join(dir, "service", "linked")); err != nil {
+		t.Fatal(err)
+	}
+	// symlink loop is walked only once
+	if err := os.Symlink(filepath.Join(dir, "service"), filepath.Join(dir, "linked", "service")); err != nil {
+		t.Fatal(err)
+	}
+	sources := []string{
+		filepath.Join(dir, "shared"),
+		filepath.Join(dir, "service"),
+		filepath.Join(dir, "extra", "orders.yml"),
+	}
+
+	cases := []struct {
+		opts LoadOptions
+		ids  []string
+	}{
+		{
+			LoadOptions{},
+			[]string{"orders", "queue", "billing/invoices", "billing/invoices_draft", "billing/old/payments", "replication"},
+		},
+		{
+			LoadOptions{Exclude: []string{"*_draft.yml", "old"}},
+			[]string{"orders", "queue", "billing/invoices", "replication"},
+		},
+		{
+			LoadOptions{Include: []string{"billing/*"}},
+			[]string{"orders", "billing/invoices", "billing/invoices_draft"},
+		},
+		{
+			LoadOptions{FollowSymlinks: true, Exclude: []string{"billing"}},
+			[]string{"orders", "linked/users", "queue", "replication"},
+		},
+	}
+	for _, c := range cases {
+		checks, err := LoadChecks(sources, c.opts)
+		if err != nil {
+			t.Fatalf("Failed to load checks: %v", err)
+		}
+		var ids []string
+		for _, check := range checks {
+			ids = append(ids, check.ID)
+		}
+		if !eqStrings(ids, c.ids) {
+			t.Errorf("Expected checks %v with options %+v, got %v", c.ids, c.opts, ids)
+		}
+	}
+
+	// checks with the same derived ID in different sources don't fail the whole run
+	other := filepath.Join(dir, "other")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(other, "replication.yml"), []byte(fmt.Sprintf(check, "other")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checks, err := LoadChecks([]string{filepath.Join(dir, "shared"), other}, LoadOptions{Strict: true, Exclude: []string{"billing"}})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	if len(checks) != 2 || checks[0].ID != "replication" || checks[1].LoadError == "" {
+		t.Errorf("Expected check replication and broken duplicate, got %v", checks)
+	}
+
+	if _, err := LoadChecks(append(sources, filepath.Join(dir, "missing")), LoadOptions{}); err == nil {
+		t.Error("Expected error for missing source")
+	}
+}
@@ -0,0 +1,254 @@
+// +build cgo
+
+package lib
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// createSQLiteDB creates SQLite database file with some data for end-to-end tests
+func createSQLiteDB(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "test.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to create SQLite database: %v", err)
+	}
+	defer db.Close()
+	statements := []string{
+		"CREATE TABLE movies (id INTEGER PRIMARY KEY, title TEXT, duration INTEGER)",
+		"INSERT INTO movies VALUES (1, 'Midnight Express', 121), (2, 'In the Loop', 0), (3, 'Repentance', 153), (4, '', NULL)",
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("Failed to prepare SQLite database: %v", err)
+		}
+	}
+	return path
+}
+
+func TestRunChecksSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := Target{Type: "sqlite", DBName: createSQLiteDB(t, dir)}
+
+	checks := []*Check{
+		{
+			Description: "Found movies with zero duration",
+			Query:       "SELECT id, title FROM movies WHERE duration = 0",
+			Assert:      "absent",
+		},
+		{
+			Description: "Movies present",
+			Query:       "SELECT id FROM movies",
+			Assert:      "present",
+		},
+		{
+			Description: "Has more than 2 movies",
+			Query:       "SELECT count(*) > 2 FROM movies",
+			Assert:      "true",
+		},
+		{
+			Description: "Has no long movies",
+			Query:       "SELECT count(*) > 0 FROM movies WHERE duration > 150",
+			Assert:      "false",
+			Severity:    "critical",
+		},
+		{
+			Description: "Too many movies",
+			Query:       "SELECT count(*) FROM movies",
+			Assert:      "threshold",
+			Warning:     "~:2",
+			Critical:    "~:10",
+		},
+		{
+			Description: "Found movies without duration",
+			Query:       "SELECT id, title, duration FROM movies WHERE duration IS NULL",
+			Assert:      "absent",
+		},
+		{
+			Description: "Cleanup movies",
+			Query:       "DELETE FROM movies",
+			Assert:      "absent",
+		},
+	}
+	results, err := RunChecks([]Target{target}, checks, RunOptions{Concurrency: 2, ProblemState: StateWarning})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s instead", err)
+	}
+	expectedResults := []CheckResult{
+		{
+			Check:    *checks[0],
+			Columns:  []string{"id", "title"},
+			Problems: []Row{TextRow("2", "In the Loop")},
+			State:    StateWarning,
+		},
+		{
+			Check: *checks[1],
+		},
+		{
+			Check: *checks[2],
+		},
+		{
+			Check:    *checks[3],
+			Problems: []Row{TextRow("Expected false, got true")},
+			State:    StateCritical,
+		},
+		{
+			Check:    *checks[4],
+			Problems: []Row{TextRow("Value 4 violates warning threshold ~:2")},
+			State:    StateWarning,
+		},
+		{
+			Check:    *checks[5],
+			Columns:  []string{"id", "title", "duration"},
+			Problems: []Row{{Cell{Value: int64(4)}, Cell{Value: ""}, Cell{}}},
+			State:    StateWarning,
+		},
+	}
+	if len(results) != len(checks) {
+		t.Fatalf("Expected %d results, got %d", len(checks), len(results))
+	}
+	for _, r := range expectedResults {
+		if !ResultInSlice(r, results) {
+			t.Errorf("Expected to find %v in results %v", r, results)
+		}
+	}
+	for _, r := range results {
+		if r.Check.Description != "Cleanup movies" {
+			continue
+		}
+		if len(r.Problems) != 1 || !strings.Contains(r.Problems[0][0].String(), "writes are not allowed") {
+			t.Errorf("Expected write to read-only database to fail, got %v", r.Problems)
+		}
+	}
+}
+
+func TestValidateChecksSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := Target{Type: "sqlite", DBName: createSQLiteDB(t, dir)}
+	checksDir := filepath.Join(dir, "checks")
+	if err := os.Mkdir(checksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `
+description: Found movies with zero duration
+query: SELECT id, title FROM movies WHERE duration = ${duration}
+assert: absent
+vars:
+  duration: "0"
+---
+description: Found series with zero duration
+query: SELECT id, title FROM series WHERE duration = 0
+assert: absent
+`
+	path := filepath.Join(checksDir, "movies.yml")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := ValidateChecks([]string{checksDir}, ValidateOptions{Targets: []Target{target}})
+	if err != nil {
+		t.Fatalf("Failed to validate checks: %v", err)
+	}
+	if len(issues) != 1 {
+		t.Fatalf("Expected 1 issue, got %v", issues)
+	}
+	if issues[0].Path != path || issues[0].Line != 8 || !strings.Contains(issues[0].Message, "no such table: series") {
+		t.Errorf("Expected error about missing table at %s:8, got %v", path, issues[0])
+	}
+}
+
+func TestLoadChecksSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := createSQLiteDB(t, dir)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{
+		"CREATE TABLE checks (id TEXT, description TEXT, query TEXT, assert TEXT, tags TEXT, disabled BOOLEAN)",
+		`INSERT INTO checks VALUES
+			('zero_duration', 'Found movies with zero duration', 'SELECT id FROM movies WHERE duration = 0', 'absent', '[movies]', 0),
+			('long', 'Found long movies', 'SELECT id FROM movies WHERE duration > 150', 'absent', NULL, 1),
+			('empty', 'No movies', 'SELECT id FROM movies', 'present', NULL, NULL),
+			('typo', 'Bad check', 'SELECT id FROM movies', 'absnet', NULL, 0)`,
+	}
+	for _, s := range statements {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("Failed to prepare SQLite database: %v", err)
+		}
+	}
+	db.Close()
+
+	checksDir := filepath.Join(dir, "checks")
+	if err := os.Mkdir(checksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := "description: Movies present\nquery: SELECT id FROM movies\nassert: present\n"
+	if err := ioutil.WriteFile(filepath.Join(checksDir, "movies.yml"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := DBSource{Target: Target{Name: "checksdb", Type: "sqlite", DBName: path}, Table: "checks"}
+	checks, err := LoadChecks([]string{checksDir}, LoadOptions{Strict: true, Databases: []DBSource{source}})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	expected := []struct {
+		id, description string
+	}{
+		{"movies", "Movies present"},
+		{"typo", "Failed to load check from checks@checksdb, row 4"},
+		{"empty", "No movies"},
+		{"zero_duration", "Found movies with zero duration"},
+	}
+	if len(checks) != len(expected) {
+		t.Fatalf("Expected to load %d checks, got %v", len(expected), checks)
+	}
+	for i, e := range expected {
+		if checks[i].ID != e.id || checks[i].Description != e.description {
+			t.Errorf("Expected check %s with description %q, got %v", e.id, e.description, *checks[i])
+		}
+	}
+	if !eqStrings(checks[3].Tags, []string{"movies"}) {
+		t.Errorf("Expected tags to be read from table, got %v", checks[3].Tags)
+	}
+
+	// checks in files and tables share IDs
+	data = "id: empty\n" + data
+	if err := ioutil.WriteFile(filepath.Join(checksDir, "movies.yml"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checks, err = LoadChecks([]string{checksDir}, LoadOptions{Strict: true, Databases: []DBSource{source}})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	if len(checks) != len(expected) || checks[2].ID != "empty@checks@checksdb" || checks[2].LoadError == "" {
+		t.Errorf("Expected broken check about duplicate check id, got %v", checks)
+	}
+
+	source.Table = "missing"
+	checks, err = LoadChecks(nil, LoadOptions{Strict: true, Databases: []DBSource{source}})
+	if err != nil {
+		t.Fatalf("Failed to load checks: %v", err)
+	}
+	if len(checks) != 1 || checks[0].ID != "missing@checksdb" || !strings.Contains(checks[0].LoadError, "no such table") {
+		t.Errorf("Expected broken check for missing table, got %v", checks)
+	}
+}
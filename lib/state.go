@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// State is a Nagios-compatible state of a CheckResult
+type State int
+
+// States are ordered by severity, same as Nagios plugin exit codes
+const (
+	StateOK State = iota
+	StateWarning
+	StateCritical
+	StateUnknown
+)
+
+var stateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+func (s State) String() string {
+	if s < StateOK || s > StateUnknown {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// ParseState converts case-insensitive state name to State
+func ParseState(name string) (State, error) {
+	for i, n := range stateNames {
+		if strings.EqualFold(name, n) {
+			return State(i), nil
+		}
+	}
+	return StateUnknown, fmt.Errorf("unknown state %q", name)
+}
+
+// MarshalJSON represents State as its name in JSON
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON reads State from its name in JSON
+func (s *State) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	state, err := ParseState(name)
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// WorstState returns the most severe State of all CheckResults
+func WorstState(results []CheckResult) State {
+	worst := StateOK
+	for _, cr := range results {
+		if cr.State > worst {
+			worst = cr.State
+		}
+	}
+	return worst
+}
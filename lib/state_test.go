@@ -0,0 +1,55 @@
+package lib
+
+import "testing"
+
+func TestParseState(t *testing.T) {
+	cases := map[string]State{
+		"ok":       StateOK,
+		"Warning":  StateWarning,
+		"CRITICAL": StateCritical,
+		"unknown":  StateUnknown,
+	}
+	for name, expected := range cases {
+		got, err := ParseState(name)
+		if err != nil {
+			t.Fatalf("Failed to parse state %s: %v", name, err)
+		}
+		if got != expected {
+			t.Errorf("Expected state %v for %s, got %v", expected, name, got)
+		}
+	}
+	if _, err := ParseState("fatal"); err == nil {
+		t.Error("Expected to fail to parse bad state")
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	data, err := StateCritical.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal state: %v", err)
+	}
+	if string(data) != `"CRITICAL"` {
+		t.Errorf("Expected state to be marshaled as name, got %s", data)
+	}
+	var s State
+	if err := s.UnmarshalJSON(data); err != nil {
+		t.Fatalf("Failed to unmarshal state: %v", err)
+	}
+	if s != StateCritical {
+		t.Errorf("Expected state %v, got %v", StateCritical, s)
+	}
+}
+
+func TestWorstState(t *testing.T) {
+	results := []CheckResult{
+		{State: StateWarning},
+		{State: StateCritical},
+		{State: StateOK},
+	}
+	if got := WorstState(results); got != StateCritical {
+		t.Errorf("Expected worst state %v, got %v", StateCritical, got)
+	}
+	if got := WorstState(nil); got != StateOK {
+		t.Errorf("Expected worst state of no results to be %v, got %v", StateOK, got)
+	}
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Target is a database to run checks against
+type Target struct {
+	Name         string   `yaml:"name"`
+	Type         string   `yaml:"type"`
+	Host         string   `yaml:"host"`
+	Port         int      `yaml:"port"`
+	DBName       string   `yaml:"dbname"`
+	User         string   `yaml:"user"`
+	Password     string   `yaml:"password"`
+	PasswordEnv  string   `yaml:"password_env"`
+	PasswordFile string   `yaml:"password_file"`
+	Params       string   `yaml:"params"`
+	Tags         []string `yaml:"tags"`
+}
+
+// String returns Target name, or DB name for unnamed Target
+func (t Target) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.DBName
+}
+
+// Validate checks if Target has all required fields
+func (t Target) Validate() error {
+	d, err := GetDriver(t.Type)
+	if err != nil {
+		return fmt.Errorf("not a valid target, %v", err)
+	}
+	if d.Validate != nil {
+		return d.Validate(t)
+	}
+	return nil
+}
+
+// port returns Target port, or default port of its driver
+func (t Target) port() int {
+	if t.Port != 0 {
+		return t.Port
+	}
+	if d, err := GetDriver(t.Type); err == nil {
+		return d.DefaultPort
+	}
+	return 0
+}
+
+// password returns Target password from first available source:
+// password, password_env, password_file, or default environment variable of its driver
+func (t Target) password(d *Driver) (string, error) {
+	switch {
+	case t.Password != "":
+		return t.Password, nil
+	case t.PasswordEnv != "":
+		return os.Getenv(t.PasswordEnv), nil
+	case t.PasswordFile != "":
+		b, err := ioutil.ReadFile(t.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	case d.PasswordEnv != "":
+		return os.Getenv(d.PasswordEnv), nil
+	}
+	return "", nil
+}
+
+// ConnString constucts connection string for Target
+func (t Target) ConnString() (string, error) {
+	d, err := GetDriver(t.Type)
+	if err != nil {
+		return "", err
+	}
+	password, err := t.password(d)
+	if err != nil {
+		return "", err
+	}
+	return d.DSN(t, password), nil
+}
+
+// ReadTargets reads list of targets from io.Reader
+func ReadTargets(f io.Reader) ([]Target, error) {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	err = yaml.Unmarshal(b, &targets)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, t := range targets {
+		if t.Name == "" {
+			return nil, fmt.Errorf("not a valid target #%d, 'name' is missing", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("not a valid target %s, duplicate 'name'", t.Name)
+		}
+		names[t.Name] = true
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no targets found")
+	}
+	return targets, nil
+}
+
+// ReadTargetsFile reads list of targets from file at filePath.
+func ReadTargetsFile(filePath string) ([]Target, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTargets(f)
+}
+
+// hasTag checks if Target has any of tags
+func (t Target) hasTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, tt := range t.Tags {
+			if tag == tt {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Issue is a problem found in checks by ValidateChecks
+type Issue struct {
+	// Path is a path to file with problem, empty for problems of targets
+	Path string
+	// Line is a line in file, zero if unknown
+	Line int
+	// Warning is set for problems which don't prevent check from running
+	Warning bool
+	Message string
+}
+
+func (i Issue) String() string {
+	level := "error"
+	if i.Warning {
+		level = "warning"
+	}
+	switch {
+	case i.Path == "":
+		return fmt.Sprintf("%s: %s", level, i.Message)
+	case i.Line == 0:
+		return fmt.Sprintf("%s: %s: %s", i.Path, level, i.Message)
+	default:
+		return fmt.Sprintf("%s:%d: %s: %s", i.Path, i.Line, level, i.Message)
+	}
+}
+
+// ValidateOptions controls validation of checks
+type ValidateOptions struct {
+	// LoadOptions select check files to validate, Strict is ignored,
+	// and Timeout also limits preparation of each query
+	LoadOptions
+	// Targets to prepare check queries on, queries are not prepared if empty
+	Targets []Target
+	// Vars override variables of checks and environment
+	Vars map[string]string
+}
+
+// isCheckKey checks if key is a name of check field
+func isCheckKey(key string) bool {
+	// query_file is replaced with query while reading check
+	_, ok := checkFields[key]
+	return ok || key == "query_file"
+}
+
+// locatedCheck is a check with location of its definition
+type locatedCheck struct {
+	check *Check
+	path  string
+	line  int
+}
+
+// validator collects issues of checks
+type validator struct {
+	issues []Issue
+	checks []locatedCheck
+	// locations of checks by their IDs and descriptions
+	ids          map[string]locatedCheck
+	descriptions map[string]locatedCheck
+}
+
+func (v *validator) add(path string, line int, warning bool, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{Path: path, Line: line, Warning: warning, Message: fmt.Sprintf(format, args...)})
+}
+
+// addError adds issue for err, located in path if err has no location
+func (v *validator) addError(path string, err error) {
+	fe, ok := err.(*fileError)
+	if !ok || fe.path == "" {
+		fe = inFile(err, path)
+	}
+	v.add(fe.path, fe.line, false, "%v", fe.err)
+}
+
+// addCheck adds valid check, unless it has duplicate ID
+func (v *validator) addCheck(lc locatedCheck) {
+	check := lc.check
+	if other, ok := v.ids[check.ID]; ok {
+		v.add(lc.path, lc.line, false, "duplicate check id %q, also in %s:%d", check.ID, other.path, other.line)
+		return
+	}
+	v.ids[check.ID] = lc
+	if other, ok := v.descriptions[check.Description]; ok {
+		v.add(lc.path, lc.line, true, "duplicate description %q, also in %s:%d", check.Description, other.path, other.line)
+	} else {
+		v.descriptions[check.Description] = lc
+	}
+	v.checks = append(v.checks, lc)
+}
+
+// unknownKeys warns about fields of item which are not check fields
+func (v *validator) unknownKeys(path string, it item) {
+	var keys []string
+	for k := range it.fields {
+		if key, ok := k.(string); !ok || !isCheckKey(key) {
+			keys = append(keys, fmt.Sprint(k))
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line, ok := it.keys[key]
+		if !ok {
+			line = it.line
+		}
+		v.add(path, line, true, "unknown key %q", key)
+	}
+}
+
+// ValidateChecks reads all checks from sources and databases like LoadChecks, but reports all problems
+// as issues instead of skipping broken files, together with unknown keys and duplicate descriptions.
+// If targets are given, queries of checks are prepared on targets they apply to.
+func ValidateChecks(sources []string, opts ValidateOptions) ([]Issue, error) {
+	v := &validator{
+		ids:          make(map[string]locatedCheck),
+		descriptions: make(map[string]locatedCheck),
+	}
+	queryFiles := make(queryFileSet)
+	var skipped []checkFile
+	err := walkCheckFiles(sources, opts.LoadOptions, func(root, path string, err error) {
+		v.addError(path, err)
+	}, func(f checkFile, d defaultsChain) error {
+		path := f.path
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			v.addError(path, err)
+			return nil
+		}
+		items, err := readFileItems(path, b)
+		if err != nil {
+			v.addError(path, err)
+			return nil
+		}
+		if isSQLFile(path) && len(items) == 0 {
+			skipped = append(skipped, f)
+			return nil
+		}
+		if isDefaultsFile(path) {
+			// errors in defaults are reported by walkCheckFiles
+			for _, it := range items {
+				v.unknownKeys(path, it)
+			}
+			return nil
+		}
+		for i, it := range items {
+			v.unknownKeys(path, it)
+			queryFiles.add(queryFileOf(it, filepath.Dir(path)))
+			check, err := readItem(it, d, filepath.Dir(path))
+			if err != nil {
+				if len(items) > 1 {
+					err = fmt.Errorf("check #%d: %v", i+1, err)
+				}
+				v.add(path, it.line, false, "%v", err)
+				continue
+			}
+			if check.ID == "" {
+				check.ID = deriveCheckID(f.root, path, i, len(items))
+			}
+			v.addCheck(locatedCheck{check: check, path: path, line: it.line})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// .sql files which are not checks are fine if they are query files of other checks
+	for _, f := range skipped {
+		if !queryFiles.has(f.path) {
+			v.add(f.path, 0, true, "file is skipped, it has no 'description' or 'assert' in leading comments and is not referenced by query_file")
+		}
+	}
+	// rows of checks tables are located by their numbers
+	for _, source := range opts.Databases {
+		items, err := readDBSourceItems(source, opts.Timeout)
+		if err != nil {
+			v.add(source.String(), 0, false, "%v", err)
+			continue
+		}
+		for _, it := range items {
+			v.unknownKeys(source.String(), it)
+			check, err := readDBItemCheck(it)
+			if err != nil {
+				v.add(source.String(), it.line, false, "%v", err)
+				continue
+			}
+			v.addCheck(locatedCheck{check: check, path: source.String(), line: it.line})
+		}
+	}
+	if len(opts.Targets) > 0 {
+		if err := v.prepareChecks(opts); err != nil {
+			return nil, err
+		}
+	}
+	return v.issues, nil
+}
+
+// prepareChecks prepares queries of valid checks on targets they apply to
+func (v *validator) prepareChecks(opts ValidateOptions) error {
+	conns, err := openConnections(opts.Targets)
+	if err != nil {
+		return err
+	}
+	defer closeConnections(conns)
+
+	// connections we failed to use are skipped
+	broken := make(map[*connection]bool)
+	for _, conn := range conns {
+		if conn.err == nil {
+			conn.err = conn.db.Ping()
+		}
+		if conn.err != nil {
+			v.add("", 0, false, "failed to connect to target %s: %v", conn.target, conn.err)
+			broken[conn] = true
+		}
+	}
+	for _, lc := range v.checks {
+		found := false
+		for _, j := range makeJobs(conns, []*Check{lc.check}) {
+			if j.conn == nil {
+				continue
+			}
+			found = true
+			if broken[j.conn] {
+				continue
+			}
+			query, args, err := lc.check.bindQuery(lc.check.Query, j.conn.driver, opts.Vars)
+			if err != nil {
+				v.add(lc.path, lc.line, false, "failed to substitute check variables: %v", err)
+				break
+			}
+			if err := prepareQuery(j.conn, query, len(args), opts.Timeout); err != nil {
+				v.add(lc.path, lc.line, false, "query fails on %s: %v", j.conn.target, err)
+			}
+			if lc.check.CompareTarget != "" && j.compare == nil {
+				v.add(lc.path, lc.line, false, "compare target %s not found", lc.check.CompareTarget)
+				break
+			}
+			if j.compare == nil || broken[j.compare] {
+				continue
+			}
+			compareQuery := lc.check.CompareQuery
+			if compareQuery == "" {
+				compareQuery = lc.check.Query
+			}
+			query, args, err = lc.check.bindQuery(compareQuery, j.compare.driver, opts.Vars)
+			if err != nil {
+				v.add(lc.path, lc.line, false, "failed to substitute check variables: %v", err)
+				break
+			}
+			if err := prepareQuery(j.compare, query, len(args), opts.Timeout); err != nil {
+				v.add(lc.path, lc.line, false, "compare query fails on %s: %v", j.compare.target, err)
+			}
+		}
+		if !found {
+			v.add(lc.path, lc.line, true, "check applies to no targets")
+		}
+	}
+	return nil
+}
+
+// prepareQuery compiles query with n arguments on connection
+// in transaction which is always rolled back
+func prepareQuery(conn *connection, query string, n int, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tx, err := conn.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: conn.driver.ReadOnlyTx})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return conn.driver.prepare(ctx, tx, query, n)
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"_defaults.yaml": "severity: critical\nowner: dba\n",
+		"good.yml":       "description: some_table empty\nquery: SELECT id FROM some_table\nassert: absent\n",
+		"list.yml": `# checks of other_table
+- description: some_table empty
+  query: SELECT id FROM some_table
+  assert: absent
+
+- description: other_table non-empty
+  query: SELECT id FROM other_table
+  asert: present
+- description: other_table small
+  query: SELECT id FROM other_table
+  assert: smaller
+`,
+		"broken.yml": "description: broken\nquery: [SELECT\n",
+		"ref.yml":    "description: referenced query\nquery_file: query.sql\nassert: absent\n",
+		"query.sql":  "-- used by ref.yml\nSELECT 1\n",
+		"plain.sql":  "SELECT 1\n",
+		"debug.sql":  "-- Helper query for manual debugging\nSELECT * FROM some_table\n",
+		"lag.sql":    "-- Replication lag check\n-- description: lag\nSELECT 1\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues, err := ValidateChecks([]string{dir}, ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate checks: %v", err)
+	}
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	expected := []Issue{
+		{Path: path("_defaults.yaml"), Line: 2, Warning: true, Message: `unknown key "owner"`},
+		{Path: path("broken.yml"), Line: 2, Message: "yaml: did not find expected ',' or ']'"},
+		{Path: path("lag.sql"), Line: 1, Message: "leading -- comments are not a valid front-matter with check fields: yaml: mapping values are not allowed in this context"},
+		{Path: path("list.yml"), Line: 2, Warning: true, Message: `duplicate description "some_table empty", also in ` + path("good.yml") + ":1"},
+		{Path: path("list.yml"), Line: 8, Warning: true, Message: `unknown key "asert"`},
+		{Path: path("list.yml"), Line: 6, Message: "check #2: not a valid check, 'assert' is missing"},
+		{Path: path("list.yml"), Line: 9, Message: `check #3: not a valid check, unknown assertion "smaller", use one of: ` +
+			"absent, present, true, false, threshold, count, equals, all, none, any, reconcile"},
+		{Path: path("debug.sql"), Warning: true, Message: "file is skipped, it has no 'description' or 'assert' in leading comments and is not referenced by query_file"},
+		{Path: path("plain.sql"), Warning: true, Message: "file is skipped, it has no 'description' or 'assert' in leading comments and is not referenced by query_file"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %d: %v", len(expected), len(issues), issues)
+	}
+	for i, issue := range expected {
+		if issues[i] != issue {
+			t.Errorf("Expected issue %v, got %v", issue, issues[i])
+		}
+	}
+}
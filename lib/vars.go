@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// VarEnvPrefix is a prefix of environment variables providing check variables,
+// so DB_CHECKER_VAR_SCHEMA sets variable schema
+const VarEnvPrefix = "DB_CHECKER_VAR_"
+
+// placeholderRe matches ${name} and ${name:modifier} variable placeholders
+var placeholderRe = regexp.MustCompile(`\$\{(\w+)(?::(\w*))?\}`)
+
+// validatePlaceholders checks that all placeholders in s have known modifiers
+func validatePlaceholders(s string) error {
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		if m[2] != "" && m[2] != "ident" {
+			return fmt.Errorf("unknown modifier %q of variable %s, only 'ident' is supported", m[2], m[1])
+		}
+	}
+	return nil
+}
+
+// lookupVar returns value of check variable from the first source having it:
+// global vars (usually from command line), environment or check vars
+func (c Check) lookupVar(name string, vars map[string]string) (string, error) {
+	if v, ok := vars[name]; ok {
+		return v, nil
+	}
+	if v, ok := os.LookupEnv(VarEnvPrefix + strings.ToUpper(name)); ok {
+		return v, nil
+	}
+	if v, ok := c.Vars[name]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("variable %s is not defined", name)
+}
+
+// expandText substitutes variables in text as is
+func (c Check) expandText(s string, vars map[string]string) (string, error) {
+	var err error
+	result := placeholderRe.ReplaceAllStringFunc(s, func(p string) string {
+		m := placeholderRe.FindStringSubmatch(p)
+		v, e := c.lookupVar(m[1], vars)
+		if e != nil {
+			err = e
+		}
+		return v
+	})
+	return result, err
+}
+
+// bindQuery replaces variables in query with driver placeholders and returns
+// their values as query arguments. Variables with ident modifier are quoted as identifiers.
+func (c Check) bindQuery(query string, d *Driver, vars map[string]string) (string, []interface{}, error) {
+	if d == nil {
+		d = &Driver{}
+	}
+	var args []interface{}
+	var err error
+	result := placeholderRe.ReplaceAllStringFunc(query, func(p string) string {
+		m := placeholderRe.FindStringSubmatch(p)
+		v, e := c.lookupVar(m[1], vars)
+		if e != nil {
+			err = e
+			return p
+		}
+		if m[2] == "ident" {
+			return d.quoteIdent(v)
+		}
+		args = append(args, v)
+		return d.placeholder(len(args))
+	})
+	return result, args, err
+}
+
+// renderCheck returns copy of check with variables substituted in description,
+// and query with driver placeholders, together with query arguments
+func renderCheck(c Check, d *Driver, vars map[string]string) (Check, []interface{}, error) {
+	rendered := c
+	var err error
+	rendered.Description, err = c.expandText(c.Description, vars)
+	if err != nil {
+		return c, nil, err
+	}
+	var args []interface{}
+	rendered.Query, args, err = c.bindQuery(c.Query, d, vars)
+	if err != nil {
+		return c, nil, err
+	}
+	return rendered, args, nil
+}
+
+// boundQuerier passes its args to every query
+type boundQuerier struct {
+	Querier
+	args []interface{}
+}
+
+func (q boundQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return q.Querier.QueryContext(ctx, query, append(append([]interface{}{}, q.args...), args...)...)
+}
+
+func (q boundQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return q.Querier.QueryRowContext(ctx, query, append(append([]interface{}{}, q.args...), args...)...)
+}
+
+// bindArgs returns Querier passing args to every query
+func bindArgs(db Querier, args []interface{}) Querier {
+	if len(args) == 0 {
+		return db
+	}
+	return boundQuerier{Querier: db, args: args}
+}
+
+// withArgs returns checker passing args to every query
+func withArgs(checker CheckFunc, args []interface{}) CheckFunc {
+	return func(ctx context.Context, db Querier, check Check) (*CheckResult, error) {
+		return checker(ctx, bindArgs(db, args), check)
+	}
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRenderCheck(t *testing.T) {
+	check := Check{
+		Description: "Stale jobs in ${schema}",
+		Query:       "SELECT id FROM ${schema:ident}.jobs WHERE age > ${max_age} AND queue = ${queue}",
+		Vars:        map[string]string{"schema": "billing", "max_age": "60", "queue": "default"},
+	}
+	os.Setenv("DB_CHECKER_VAR_MAX_AGE", "120")
+	defer os.Unsetenv("DB_CHECKER_VAR_MAX_AGE")
+	vars := map[string]string{"queue": "urgent"}
+
+	cases := []struct {
+		dbType string
+		query  string
+	}{
+		{"postgres", `SELECT id FROM "billing".jobs WHERE age > $1 AND queue = $2`},
+		{"mysql", "SELECT id FROM `billing`.jobs WHERE age > ? AND queue = ?"},
+		{"sqlite", `SELECT id FROM "billing".jobs WHERE age > ? AND queue = ?`},
+		{"sqlserver", "SELECT id FROM [billing].jobs WHERE age > @p1 AND queue = @p2"},
+	}
+	for _, c := range cases {
+		d, err := GetDriver(c.dbType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rendered, args, err := renderCheck(check, d, vars)
+		if err != nil {
+			t.Fatalf("Failed to render check for %s: %v", c.dbType, err)
+		}
+		if rendered.Description != "Stale jobs in billing" {
+			t.Errorf("Unexpected description %q", rendered.Description)
+		}
+		if rendered.Query != c.query {
+			t.Errorf("Expected %s query %q, got %q", c.dbType, c.query, rendered.Query)
+		}
+		expectedArgs := []interface{}{"120", "urgent"}
+		if !reflect.DeepEqual(args, expectedArgs) {
+			t.Errorf("Expected args %v, got %v", expectedArgs, args)
+		}
+	}
+
+	check.Query = `SELECT 1 FROM ${table:ident}`
+	if _, _, err := renderCheck(check, nil, nil); err == nil {
+		t.Error("Expected to fail to render check with undefined variable")
+	}
+	check.Vars["table"] = `jobs"; DROP TABLE jobs; --`
+	rendered, _, err := renderCheck(check, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to render check: %v", err)
+	}
+	if rendered.Query != `SELECT 1 FROM "jobs""; DROP TABLE jobs; --"` {
+		t.Errorf("Identifier is not quoted properly in %q", rendered.Query)
+	}
+}
+
+func TestReadCheckBadPlaceholder(t *testing.T) {
+	data := `
+description: Some description
+query: SELECT * FROM ${table:raw}
+assert: absent
+`
+	if _, err := ReadCheck(strings.NewReader(data)); err == nil {
+		t.Error("Expected to fail to read check with unknown placeholder modifier")
+	}
+}
+
+func TestRunChecksVars(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	checks := []*Check{
+		{
+			Description: "Queue ${queue} is not empty",
+			Query:       "SELECT id FROM jobs WHERE queue = ${queue}",
+			Assert:      "absent",
+			Vars:        map[string]string{"queue": "default"},
+		},
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM jobs WHERE queue = \?`).
+		WithArgs("urgent").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).FromCSVString("1"))
+	mock.ExpectRollback()
+
+	results := runJobs(makeJobs([]*connection{{db: db}}, checks), RunOptions{
+		Concurrency: 1,
+		Vars:        map[string]string{"queue": "urgent"},
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if results[0].Check.Description != "Queue urgent is not empty" {
+		t.Errorf("Unexpected description %q", results[0].Check.Description)
+	}
+	if len(results[0].Problems) != 1 {
+		t.Errorf("Expected 1 problem, got %v", results[0].Problems)
+	}
+}
+
+func TestRunChecksMissingVar(t *testing.T) {
+	// open database stub
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	checks := []*Check{
+		{
+			Description: "Queue ${queue} is not empty",
+			Query:       "SELECT id FROM jobs WHERE queue = ${queue}",
+			Assert:      "absent",
+			Severity:    "critical",
+		},
+	}
+	results := runJobs(makeJobs([]*connection{{db: db}}, checks), RunOptions{Concurrency: 1, ProblemState: StateWarning})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if results[0].State != StateUnknown {
+		t.Errorf("Expected check with missing variable to be UNKNOWN, got %v", results[0].State)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abulimov/db-checker/lib"
+)
+
+var argListen = flag.String("listen", ":9131", "Address to listen on in serve mode")
+var argInterval = flag.Duration("interval", lib.DefaultInterval, "Interval between runs of each check in serve mode (checks can override it with 'interval' field)")
+var argServer = flag.String("server", "", "URL of db-checker in serve mode to get latest results from, instead of running checks")
+
+// serve runs checks on their intervals and serves latest results over HTTP,
+// both as JSON report and as Prometheus metrics
+func serve() {
+	if err := validateArgs(); err != nil {
+		lib.Error.Fatalln(err)
+	}
+
+	if err := selector().Validate(); err != nil {
+		lib.Error.Fatalln(err)
+	}
+
+	checks, summary, err := getChecks()
+	if err != nil {
+		lib.Error.Fatalln(err)
+	}
+	if summary != "" {
+		log.Println(summary)
+	}
+
+	targets, err := getTargets()
+	if err != nil {
+		lib.Error.Fatalln(err)
+	}
+
+	scheduler, err := lib.NewScheduler(targets, checks, *argInterval, runOptions())
+	if err != nil {
+		lib.Error.Fatalln(err)
+	}
+	go scheduler.Run(context.Background())
+
+	http.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := lib.WriteReport(scheduler.Results(), w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := scheduler.WriteMetrics(w, *argDBName); err != nil {
+			lib.Error.Printf("Failed to write metrics: %v\n", err)
+		}
+	})
+	lib.Error.Fatalln(http.ListenAndServe(*argListen, nil))
+}
+
+// fetchResults gets latest results from db-checker in serve mode
+func fetchResults(server string) ([]lib.CheckResult, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimRight(server, "/") + "/results")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get results from %s: %s", server, resp.Status)
+	}
+	return lib.ReadReport(resp.Body)
+}
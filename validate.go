@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/abulimov/db-checker/lib"
+)
+
+var argPrepare = flag.Bool("prepare", false, "In validate mode, prepare check queries on targets to find SQL errors")
+
+// validate checks all check files and prints found issues, exiting with status 1
+// if there are errors, or with status 2 if checks could not be validated at all
+func validate() {
+	if !hasChecksSources() {
+		fmt.Fprintln(os.Stderr, "'checks' or 'checks-table' option is required!")
+		os.Exit(2)
+	}
+	loadOpts, err := loadOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	opts := lib.ValidateOptions{LoadOptions: loadOpts, Vars: argVars}
+	if *argPrepare {
+		if err := validateArgs(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		targets, err := getTargets()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.Targets = targets
+	}
+
+	issues, err := lib.ValidateChecks(argChecks, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	errorsCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if !issue.Warning {
+			errorsCount++
+		}
+	}
+	fmt.Printf("%d errors, %d warnings\n", errorsCount, len(issues)-errorsCount)
+	if errorsCount > 0 {
+		os.Exit(1)
+	}
+}